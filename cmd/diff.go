@@ -0,0 +1,294 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+var (
+	diffCmd = &cobra.Command{
+		Use:   "diff <source1> <source2>",
+		Short: "compare TNS entries of two sources",
+		Long: `compare the TNS entries of two sources and print added, removed and changed aliases.
+A source is a tnsnames.ora file, a directory containing tnsnames.ora,
+"ldap" for the configured Oracle Context or "ldap:<context DN>"`,
+		Args:         cobra.ExactArgs(2),
+		RunE:         diffTns,
+		SilenceUsage: true,
+	}
+)
+
+const ldapSource = "ldap"
+
+var diffOutput = outputText
+var diffAll = false
+
+// descChange is one changed value of a descriptor
+type descChange struct {
+	Path string `json:"path" yaml:"path"`
+	Old  string `json:"old" yaml:"old"`
+	New  string `json:"new" yaml:"new"`
+}
+
+// tnsDiff describes the difference of one alias between two sources
+type tnsDiff struct {
+	Alias     string       `json:"alias" yaml:"alias"`
+	Status    string       `json:"status" yaml:"status"`
+	From      string       `json:"from,omitempty" yaml:"from,omitempty"`
+	To        string       `json:"to,omitempty" yaml:"to,omitempty"`
+	Changes   []descChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+	key       string
+	fromEntry *dblib.TNSEntry
+	toEntry   *dblib.TNSEntry
+}
+
+// diffReport is the structured output of the diff command
+type diffReport struct {
+	From    string         `json:"from" yaml:"from"`
+	To      string         `json:"to" yaml:"to"`
+	Entries []tnsDiff      `json:"entries" yaml:"entries"`
+	Summary map[string]int `json:"summary" yaml:"summary"`
+}
+
+// tnsSource holds the loaded entries of one diff source
+type tnsSource struct {
+	Name    string
+	Entries dblib.TNSEntries
+	Domain  string
+	IsLdap  bool
+	Context string
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", diffOutput, "output format: text, json or yaml")
+	diffCmd.Flags().BoolVar(&diffAll, "all", false, "list unchanged aliases as well")
+	RootCmd.AddCommand(diffCmd)
+}
+
+func diffTns(_ *cobra.Command, args []string) (err error) {
+	format, err := checkOutputFormat(diffOutput, outputText, outputJSON, outputYAML)
+	if err != nil {
+		return
+	}
+	from, err := loadTnsSource(args[0])
+	if err != nil {
+		err = fmt.Errorf("load %s failed: %v", args[0], err)
+		return
+	}
+	to, err := loadTnsSource(args[1])
+	if err != nil {
+		err = fmt.Errorf("load %s failed: %v", args[1], err)
+		return
+	}
+	// LDAP stores normalized aliases, so compare file entries the same way
+	fromKey, toKey := strings.ToUpper, strings.ToUpper
+	switch {
+	case from.IsLdap && to.IsLdap:
+		fromKey, toKey = ldapKey, ldapKey
+	case from.IsLdap:
+		fromKey = ldapKey
+		toKey, err = aliasKey(to.Domain)
+	case to.IsLdap:
+		toKey = ldapKey
+		fromKey, err = aliasKey(from.Domain)
+	}
+	if err != nil {
+		return
+	}
+	diffs := diffTNS(from.Entries, to.Entries, fromKey, toKey, descEquivalent)
+	report := diffReport{From: from.Name, To: to.Name, Entries: []tnsDiff{}, Summary: map[string]int{sNew: 0, sDel: 0, sMod: 0, sOK: 0}}
+	for _, d := range diffs {
+		report.Summary[d.Status]++
+		if d.Status == sMod {
+			d.Changes = descChanges(d.fromEntry.Desc, d.toEntry.Desc)
+		}
+		if d.Status != sOK || diffAll {
+			report.Entries = append(report.Entries, d)
+		}
+	}
+	log.Infof("%d added, %d removed, %d changed, %d unchanged",
+		report.Summary[sNew], report.Summary[sDel], report.Summary[sMod], report.Summary[sOK])
+	if format == outputText {
+		err = writeDiffText(os.Stdout, report)
+	} else {
+		err = writeStructured(os.Stdout, format, report)
+	}
+	return
+}
+
+// loadTnsSource loads the entries from a file, a directory or a LDAP context
+func loadTnsSource(source string) (s tnsSource, err error) {
+	s.Name = source
+	if source == ldapSource || strings.HasPrefix(source, ldapSource+":") {
+		s.IsLdap = true
+		lc, e := ldapConnectServer()
+		if e != nil {
+			err = e
+			return
+		}
+		// each source keeps its own context, the configured one is the default
+		dn := contextDN
+		if ctx := strings.TrimPrefix(source, ldapSource+":"); ctx != source {
+			dn = ctx
+		}
+		if s.Context, err = findOracleContext(lc, dn); err != nil {
+			return
+		}
+		s.Name = ldapSource + ":" + s.Context
+		if s.Entries, err = dblib.ReadLdapTns(lc, s.Context); err != nil {
+			return
+		}
+		aliases, e := readLdapAliases(lc, s.Context)
+		if e != nil {
+			err = e
+			return
+		}
+		s.Entries = mergeLdapAliases(s.Entries, aliases)
+		return
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		return
+	}
+	file := source
+	if fi.IsDir() {
+		file = path.Join(source, "tnsnames.ora")
+	}
+	s.Name = file
+	s.Entries, s.Domain, err = dblib.GetTnsnames(file, true)
+	return
+}
+
+// diffTNS compares two sets of entries. Aliases are matched by the given key
+// functions and equal decides if two descriptors are the same. The result is
+// sorted by key and has the status sNew, sDel, sMod or sOK seen from "from"
+func diffTNS(from, to dblib.TNSEntries, fromKey, toKey func(string) string, equal func(string, string) bool) (diffs []tnsDiff) {
+	fromIdx := map[string]dblib.TNSEntry{}
+	for _, e := range from {
+		fromIdx[fromKey(e.Name)] = e
+	}
+	toIdx := map[string]dblib.TNSEntry{}
+	for _, e := range to {
+		toIdx[toKey(e.Name)] = e
+	}
+	keys := make([]string, 0, len(fromIdx)+len(toIdx))
+	for k := range fromIdx {
+		keys = append(keys, k)
+	}
+	for k := range toIdx {
+		if _, ok := fromIdx[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d := tnsDiff{key: k}
+		f, inFrom := fromIdx[k]
+		t, inTo := toIdx[k]
+		if inFrom {
+			d.fromEntry = &f
+			d.Alias = f.Name
+			d.From = f.Location
+		}
+		if inTo {
+			d.toEntry = &t
+			d.Alias = t.Name
+			d.To = t.Location
+		}
+		switch {
+		case !inFrom:
+			d.Status = sNew
+		case !inTo:
+			d.Status = sDel
+		case equal(f.Desc, t.Desc):
+			d.Status = sOK
+		default:
+			d.Status = sMod
+		}
+		diffs = append(diffs, d)
+	}
+	return
+}
+
+// descEqual compares descriptors literally
+func descEqual(a string, b string) bool {
+	return a == b
+}
+
+// descEquivalent compares descriptors ignoring formatting and keyword case
+func descEquivalent(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	return len(descChanges(a, b)) == 0
+}
+
+// descChanges lists the values which differ between two descriptors
+func descChanges(a string, b string) (changes []descChange) {
+	na, errA := parseDescriptor(a, 1)
+	nb, errB := parseDescriptor(b, 1)
+	if errA != nil || errB != nil {
+		ca, cb := strings.Join(strings.Fields(a), ""), strings.Join(strings.Fields(b), "")
+		if ca != cb {
+			changes = append(changes, descChange{Old: ca, New: cb})
+		}
+		return
+	}
+	pa, pb := flattenDescriptor(na), flattenDescriptor(nb)
+	vb := map[string]string{}
+	for _, p := range pb {
+		vb[p.Path] = p.Value
+	}
+	seen := map[string]bool{}
+	for _, p := range pa {
+		seen[p.Path] = true
+		v, ok := vb[p.Path]
+		switch {
+		case !ok:
+			changes = append(changes, descChange{Path: p.Path, Old: p.Value})
+		case !strings.EqualFold(v, p.Value):
+			changes = append(changes, descChange{Path: p.Path, Old: p.Value, New: v})
+		}
+	}
+	for _, p := range pb {
+		if !seen[p.Path] {
+			changes = append(changes, descChange{Path: p.Path, New: p.Value})
+		}
+	}
+	return
+}
+
+// writeDiffText prints the diff in a human readable form
+func writeDiffText(w io.Writer, report diffReport) (err error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", report.From, report.To)
+	marks := map[string]string{sNew: "+", sDel: "-", sMod: "~", sOK: " "}
+	for _, d := range report.Entries {
+		fmt.Fprintf(&sb, "%s %s\n", marks[d.Status], d.Alias)
+		for _, c := range d.Changes {
+			p := c.Path
+			if p == "" {
+				p = "descriptor"
+			}
+			fmt.Fprintf(&sb, "    %s: %s -> %s\n", p, diffValue(c.Old), diffValue(c.New))
+		}
+	}
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+func diffValue(v string) string {
+	if v == "" {
+		return "<none>"
+	}
+	return v
+}
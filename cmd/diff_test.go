@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestDiff(t *testing.T) {
+	from := dblib.TNSEntries{
+		"XE.local": {Name: "XE.local", Location: "a.ora Line: 1",
+			Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=XE)))"},
+		"XE1.local": {Name: "XE1.local", Location: "a.ora Line: 2",
+			Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=XE1)))"},
+		"OLD.local": {Name: "OLD.local", Location: "a.ora Line: 3",
+			Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=OLD)))"},
+	}
+	to := dblib.TNSEntries{
+		"xe.local": {Name: "xe.local", Location: "b.ora Line: 1",
+			Desc: "(description =\n  (address=(protocol=TCP)(host=db1)(port=1521))\n  (connect_data=(service_name=XE)))"},
+		"XE1.local": {Name: "XE1.local", Location: "b.ora Line: 5",
+			Desc: "(DESCRIPTION=(ADDRESS_LIST=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(ADDRESS=(PROTOCOL=TCP)(HOST=db2)(PORT=1521)))" +
+				"(CONNECT_DATA=(SERVICE_NAME=XE1)))"},
+		"NEW.local": {Name: "NEW.local", Location: "b.ora Line: 9",
+			Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db3)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=NEW)))"},
+	}
+
+	diffs := diffTNS(from, to, strings.ToUpper, strings.ToUpper, descEquivalent)
+	require.Equal(t, 4, len(diffs), "4 aliases expected")
+	status := map[string]string{}
+	for _, d := range diffs {
+		status[d.key] = d.Status
+	}
+	t.Run("status", func(t *testing.T) {
+		assert.Equal(t, sNew, status["NEW.LOCAL"], "NEW should be added")
+		assert.Equal(t, sDel, status["OLD.LOCAL"], "OLD should be removed")
+		assert.Equal(t, sMod, status["XE1.LOCAL"], "XE1 should be changed")
+		assert.Equal(t, sOK, status["XE.LOCAL"], "XE should be equal ignoring format and case")
+	})
+	t.Run("literal compare", func(t *testing.T) {
+		d := diffTNS(from, to, strings.ToUpper, strings.ToUpper, descEqual)
+		for _, e := range d {
+			if e.key == "XE.LOCAL" {
+				assert.Equal(t, sMod, e.Status, "XE should differ literally")
+			}
+		}
+	})
+	t.Run("ldap keys", func(t *testing.T) {
+		ldap := dblib.TNSEntries{"xe": {Name: "xe", Location: "cn=xe,cn=OracleContext", Desc: from["XE.local"].Desc}}
+		d := diffTNS(ldap, from, ldapKey, shortAlias, descEqual)
+		require.Equal(t, 3, len(d), "3 aliases expected")
+		assert.Equal(t, "xe", d[1].key, "key not expected")
+		assert.Equal(t, sOK, d[1].Status, "xe should be equal")
+	})
+	t.Run("descriptor changes", func(t *testing.T) {
+		changes := descChanges(from["XE1.local"].Desc, to["XE1.local"].Desc)
+		t.Logf("%v", changes)
+		paths := map[string]descChange{}
+		for _, c := range changes {
+			paths[c.Path] = c
+		}
+		assert.Equal(t, "db1", paths["DESCRIPTION/ADDRESS/HOST"].Old, "removed address not expected")
+		assert.Equal(t, "db2", paths["DESCRIPTION/ADDRESS_LIST/ADDRESS[2]/HOST"].New, "new address not expected")
+	})
+	t.Run("text output", func(t *testing.T) {
+		report := diffReport{From: "a.ora", To: "b.ora"}
+		for _, d := range diffs {
+			if d.Status == sMod {
+				d.Changes = descChanges(d.fromEntry.Desc, d.toEntry.Desc)
+			}
+			report.Entries = append(report.Entries, d)
+		}
+		var sb strings.Builder
+		err := writeDiffText(&sb, report)
+		require.NoErrorf(t, err, "write failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "+ NEW.local\n")
+		assert.Contains(t, out, "- OLD.local\n")
+		assert.Contains(t, out, "~ XE1.local\n")
+		assert.Contains(t, out, "    DESCRIPTION/ADDRESS/HOST: db1 -> <none>\n")
+	})
+}
@@ -3,6 +3,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"sort"
@@ -16,18 +17,38 @@ import (
 	"github.com/tommi2day/gomodules/ldaplib"
 )
 
+const (
+	formatTNS  = "tns"
+	formatLdif = "ldif"
+)
+
 const (
 	sOK     = "ok"
 	sNew    = "new"
 	sMod    = "mod"
 	sDel    = "del"
 	sSkip   = "skip"
+	sKeep   = "keep"
 	cmdLdap = "ldap"
 )
 
 // TWorkStatus structure to handover statistics
 type TWorkStatus map[string]int
 
+// ldapPlanItem is one operation of ldap write or clear
+type ldapPlanItem struct {
+	Alias   string
+	Action  string
+	DN      string
+	Changes []descChange
+	// AliasOf is the target DN of an orclNetServiceAlias object
+	AliasOf string
+	// desc is the descriptor to write for new and modified aliases
+	desc string
+	// prev is the descriptor or alias target before the change, used for rollback
+	prev string
+}
+
 var inputReader = os.Stdin
 var (
 	// check represents the list command
@@ -82,8 +103,21 @@ var ldapInsecure = false
 var ldapTLS = false
 var ldapTimeout = 20
 var tnsTarget = tnsAdmin + "/tnsnames.ora"
+var ldapDryRun = false
+var ldapReadFormat = formatTNS
+var ldapLdifOut = ""
+var ldapNoDelete = false
+var ldapAtomic = false
+var ldapProtect = ""
+var ldapProtectRe *regexp.Regexp
 var dropRe = regexp.MustCompile(`\..*$`)
 
+// ldapKeepOptions decide which planned changes are turned into sKeep
+type ldapKeepOptions struct {
+	noDelete bool
+	protect  *regexp.Regexp
+}
+
 func init() {
 	ldapCmd.PersistentFlags().StringVarP(&ldapServer, "ldap.host", "H", "", "Hostname of Ldap Server")
 	ldapCmd.PersistentFlags().IntVarP(&ldapPort, "ldap.port", "p", ldapPort, "ldapport to connect, 0 means TLS flag will decide")
@@ -97,11 +131,20 @@ func init() {
 	RootCmd.AddCommand(ldapCmd)
 
 	ldapReadCmd.Flags().StringVarP(&tnsTarget, "ldap.tnstarget", "t", "", "filename to save ldap entries or stdout")
+	ldapReadCmd.Flags().StringVar(&ldapReadFormat, "format", ldapReadFormat, "output format: tns, ora (generated tnsnames.ora) or ldif")
 	ldapCmd.AddCommand(ldapReadCmd)
 
 	ldapWriteCmd.Flags().StringVarP(&filename, "ldap.tnssource", "s", filename, "filename to read entries")
+	ldapWriteCmd.Flags().BoolVar(&ldapDryRun, "dry-run", false, "print planned changes only, do not modify LDAP")
+	ldapWriteCmd.Flags().BoolVar(&ldapNoDelete, "no-delete", false, "only add and update aliases, never delete")
+	ldapWriteCmd.Flags().BoolVar(&ldapAtomic, "atomic", false, "roll back all changes if one operation fails")
+	ldapWriteCmd.Flags().StringVar(&ldapProtect, "protect", "", "regex of LDAP aliases which must never be changed or deleted")
+	ldapWriteCmd.Flags().StringVar(&ldapLdifOut, "ldif-out", "", "write the planned changes as LDIF change records to this file")
+	ldapWriteCmd.Flags().StringVar(&ldapAliasFile, "aliases", "", "file with 'alias = target' lines to write as orclNetServiceAlias objects")
 	ldapCmd.AddCommand(ldapWriteCmd)
 
+	ldapClearCmd.Flags().BoolVar(&ldapDryRun, "dry-run", false, "print entries to delete only, do not modify LDAP")
+	ldapClearCmd.Flags().StringVar(&ldapProtect, "protect", "", "regex of LDAP aliases which must never be deleted")
 	ldapCmd.AddCommand(ldapClearCmd)
 }
 
@@ -141,116 +184,173 @@ func initLdapConfig() {
 	if ldapTimeout == 0 {
 		ldapTimeout = viper.GetInt("ldap.timeout")
 	}
+	if !ldapNoDelete {
+		ldapNoDelete = viper.GetBool("ldap.nodelete")
+	}
+	if ldapProtect == "" {
+		ldapProtect = viper.GetString("ldap.protect")
+	}
+	if !ldapAtomic {
+		ldapAtomic = viper.GetBool("ldap.atomic")
+	}
+	if !ldapContinueOnError {
+		ldapContinueOnError = viper.GetBool("ldap.continue_on_error")
+	}
+	if ldapBackupDir == "" {
+		ldapBackupDir = viper.GetString("ldap.backupdir")
+	}
+	if ldapBackupKeep == 0 {
+		ldapBackupKeep = viper.GetInt("ldap.backupkeep")
+	}
+	if !ldapNoBackup {
+		ldapNoBackup = viper.GetBool("ldap.nobackup")
+	}
+	if ldapBackupKeep == 0 {
+		ldapBackupKeep = defaultBackupKeep
+	}
+	initLdapBindConfig()
+	initAliasConfig()
 }
 
 func ldapConnect() (lc *ldaplib.LdapConfigType, err error) {
-	var servers []dblib.LdapServer
+	lc, err = ldapConnectServer()
+	if err != nil {
+		return
+	}
+	err = selectOracleContext(lc)
+	return
+}
 
+// ldapConnectServer binds to the configured or ldap.ora LDAP server without selecting a context
+func ldapConnectServer() (lc *ldaplib.LdapConfigType, err error) {
+	servers, err := ldapPrepare()
+	if err != nil {
+		return
+	}
+	lc, err = doConnect(servers)
+	if err != nil {
+		log.Errorf("ldap connect failed:%s", err)
+	}
+	return
+}
+
+// ldapPrepare reads the servers and a missing context from ldap.ora and asks for a missing bind password
+func ldapPrepare() (servers []dblib.LdapServer, err error) {
+	ctx, servers := dblib.ReadLdapOra(tnsAdmin)
 	if len(contextDN) == 0 {
-		contextDN, servers = dblib.ReadLdapOra(tnsAdmin)
+		contextDN = ctx
 	}
 	if len(ldapBaseDN) == 0 && len(contextDN) > 0 {
 		ldapBaseDN = strings.ReplaceAll(contextDN, "cn=OracleContext,", "")
 	}
-	if ldapBindPassword == "" && ldapBindDN != "" {
+	if err = checkBindConfig(); err != nil {
+		return
+	}
+	if ldapBindPassword == "" && ldapBindDN != "" && ldapBindMech == bindSimple {
 		log.Debugf("Ask for Bind Password")
 		ldapBindPassword, _ = promptPassword("Enter LDAP Bind Password:")
 		if ldapBindPassword == "" {
 			err = fmt.Errorf("no bind password given")
-			return
 		}
 	}
-	lc, err = doConnect(servers)
-	if err != nil {
-		log.Errorf("ldap connect failed:%s", err)
-		return
-	}
+	return
+}
+
+// selectOracleContext verifies the Oracle Context below contextDN or the base DN and sets contextDN
+func selectOracleContext(lc *ldaplib.LdapConfigType) (err error) {
+	contextDN, err = findOracleContext(lc, contextDN)
+	return
+}
+
+// findOracleContext verifies the Oracle Context dn or searches one below the base DN if dn is empty
+func findOracleContext(lc *ldaplib.LdapConfigType, dn string) (c string, err error) {
 	// check
 	base := ldapBaseDN
-	if contextDN != "" {
-		base = contextDN
+	if dn != "" {
+		base = dn
 	}
-	c, err := dblib.GetOracleContext(lc, base)
+	c, err = dblib.GetOracleContext(lc, base)
 	// verify
 	if c == "" {
-		err = fmt.Errorf("no Oracle Context found/verified on base %s (%s):%s", ldapBaseDN, contextDN, err)
+		err = fmt.Errorf("no Oracle Context found/verified on base %s (%s):%s", ldapBaseDN, dn, err)
 	} else {
-		log.Infof("Oracle Context selected: %s", contextDN)
+		log.Infof("Oracle Context selected: %s", c)
 	}
-	contextDN = c
 	return
 }
 
-// separate function to make gocyclo happy
+// doConnect connects to the only server or probes all servers and uses the fastest healthy one
 func doConnect(servers []dblib.LdapServer) (lc *ldaplib.LdapConfigType, err error) {
-	switch {
-	case ldapServer != "":
-		log.Debugf("Try to connect to Ldap Server %s, Port %d, TLS %v, Insecure %v", ldapServer, ldapPort, ldapTLS, ldapInsecure)
-		lc = ldaplib.NewConfig(ldapServer, ldapPort, ldapTLS, ldapInsecure, ldapBaseDN, ldapTimeout)
-		err = lc.Connect(ldapBindDN, ldapBindPassword)
+	candidates := ldapCandidates(servers, false)
+	switch len(candidates) {
+	case 0:
+		err = fmt.Errorf("no Ldap Servers configured")
+	case 1:
+		c := candidates[0]
+		log.Debugf("Try to connect to Ldap Server %s, Port %d, TLS %v, StartTLS %v, Insecure %v, Bind %s", c.Host, c.Port, c.TLS, c.StartTLS, ldapInsecure, ldapBindMech)
+		lc, err = ldapBind(c)
 		if err == nil && lc.Conn != nil {
 			log.Debugf("Ldap Connected")
 		}
-	case len(servers) > 0 && ldapServer == "":
-		log.Debug("Try to use LDAP Server from ldap.ora")
-		for _, s := range servers {
-			lServer := s.Hostname
-			lPort := s.Port
-			sslport := s.SSLPort
-			lTLS := false
-			if sslport > 0 {
-				lPort = sslport
-				lTLS = true
-			}
-			log.Debugf("Try to connect to Ldap Server %s, Port %d", ldapServer, ldapPort)
-			lc = ldaplib.NewConfig(lServer, lPort, lTLS, ldapInsecure, ldapBaseDN, ldapTimeout)
-			err = lc.Connect(ldapBindDN, ldapBindPassword)
-			if err == nil && lc.Conn != nil {
-				log.Debugf("Connect to Ldap Server %s, Port %d, TLS:%v", lServer, lPort, lTLS)
-				ldapServer = lServer
-				ldapPort = lPort
-				ldapTLS = lTLS
-				break
+	default:
+		log.Debugf("Probe %d Ldap Servers", len(candidates))
+		probes := probeLdapServers(candidates)
+		best := fastestLdapServer(probes)
+		if best == nil {
+			// keep the config of the last server for error reporting
+			last := candidates[len(candidates)-1]
+			lc = ldaplib.NewConfig(last.Host, last.Port, last.TLS, ldapInsecure, ldapBaseDN, ldapTimeout)
+			errs := make([]string, 0, len(probes))
+			for _, p := range probes {
+				errs = append(errs, fmt.Sprintf("%s:%d %s", p.Server, p.Port, p.Error))
 			}
+			err = fmt.Errorf("no healthy Ldap Server: %s", strings.Join(errs, "; "))
+			return
+		}
+		lc = best.lc
+		log.Debugf("Connect to Ldap Server %s, Port %d, TLS:%v, StartTLS:%v in %dms", best.Server, best.Port, best.TLS, best.StartTLS, best.ConnectMS)
+		if best.Source == sourceLdapOra {
+			ldapServer = best.Server
+			ldapPort = best.Port
+			ldapTLS = best.TLS
 		}
-	default:
-		err = fmt.Errorf("no Ldap Servers configured")
 	}
 	return
 }
 
 func ldapWrite() (err error) {
-	var tnsEntries dblib.TNSEntries
-	var domain string
-
 	// print version
 	version := GetVersion(false)
 	log.Info(version)
 
-	if filename == "" {
-		err = fmt.Errorf("no input file to load given")
+	ldapProtectRe, err = protectRegex(ldapProtect)
+	if err != nil {
 		return
 	}
-	tnsEntries, domain, err = dblib.GetTnsnames(filename, true)
-	l := len(tnsEntries)
-	if err != nil || l == 0 {
-		if err == nil {
-			err = fmt.Errorf("no Entries found")
-		}
-		log.Error(err)
+	targets, err := loadLdapTargets()
+	if err != nil {
+		return
+	}
+	if len(targets) > 0 && !ldapCmd.PersistentFlags().Changed("ldap.oraclectx") {
+		return ldapWriteTargets(targets)
+	}
+
+	if filename == "" {
+		err = fmt.Errorf("no input file to load given")
 		return
 	}
 	lc, err := ldapConnect()
 	if err != nil {
 		return
 	}
-	// write to ldap
-	_, err = WriteLdapTns(lc, tnsEntries, domain, contextDN)
+	_, err = writeLdapTarget(lc, ldapTarget{Context: contextDN, Source: filename, Aliases: ldapAliasFile})
 	if err != nil {
-		err = fmt.Errorf("write to ldap failed: %v", err)
 		log.Error(err)
 		return
 	}
+	if ldapDryRun {
+		return
+	}
 	log.Infof("SUCCESS: '%s' written to LDAP\n", filename)
 	fmt.Println("Finished successfully. For details run with --info or --debug")
 	return
@@ -258,16 +358,23 @@ func ldapWrite() (err error) {
 
 func ldapRead() (err error) {
 	var fo *os.File
-	lc, err := ldapConnect()
-	if err != nil {
+	if ldapReadFormat != formatTNS && ldapReadFormat != formatLdif && ldapReadFormat != formatOra {
+		err = fmt.Errorf("invalid format %s, use %s, %s or %s", ldapReadFormat, formatTNS, formatOra, formatLdif)
 		return
 	}
-	// load available tns entries
-	tnsEntries, err := dblib.ReadLdapTns(lc, contextDN)
+	if err = checkOraFlags(ldapReadFormat, tnsTarget); err != nil {
+		return
+	}
+	if err = checkWatchFlags(tnsTarget); err != nil {
+		return
+	}
+	lc, err := ldapConnect()
 	if err != nil {
-		err = fmt.Errorf("read failed:%s", err)
 		return
 	}
+	if ldapWatch {
+		return watchLdapTns(lc, tnsTarget)
+	}
 	if tnsTarget == "" {
 		fo = os.Stdout
 		log.Debug("write to StdOut")
@@ -285,12 +392,43 @@ func ldapRead() (err error) {
 			}
 		}()
 	}
-	if len(tnsEntries) > 0 {
-		err = outputTNS(tnsEntries, fo, true)
+	n, err := renderLdapTns(lc, fo)
+	if err == nil {
+		log.Infof("SUCCESS: %d LDAP entries found\n", n)
 	}
+	return
+}
 
-	if err == nil {
-		log.Infof("SUCCESS: %d LDAP entries found\n", len(tnsEntries))
+// renderLdapTns reads the entries and alias objects of the context and writes them in the selected format.
+// n is the number of entries and alias objects found
+func renderLdapTns(lc *ldaplib.LdapConfigType, w io.Writer) (n int, err error) {
+	// load available tns entries
+	tnsEntries, err := dblib.ReadLdapTns(lc, contextDN)
+	if err != nil {
+		err = fmt.Errorf("read failed:%s", err)
+		return
+	}
+	aliases, err := readLdapAliases(lc, contextDN)
+	if err != nil {
+		err = fmt.Errorf("read failed:%s", err)
+		return
+	}
+	n = len(tnsEntries) + len(aliases)
+	switch {
+	case n == 0:
+	case ldapReadFormat == formatLdif:
+		err = writeLdifEntries(w, tnsEntries, contextDN)
+		if err == nil {
+			err = writeLdifAliases(w, aliases)
+		}
+	case ldapReadFormat == formatOra:
+		var groupOf func(dblib.TNSEntry) string
+		groupOf, err = ldapGroupFunc(lc, contextDN, tnsGroupBy)
+		if err == nil {
+			err = writeOraFiles(w, mergeLdapAliases(tnsEntries, aliases), groupOf, tnsTarget)
+		}
+	default:
+		err = outputTNS(mergeLdapAliases(tnsEntries, aliases), w, true)
 	}
 	return
 }
@@ -300,10 +438,26 @@ func ldapClear() (err error) {
 	version := GetVersion(false)
 	log.Info(version)
 
+	ldapProtectRe, err = protectRegex(ldapProtect)
+	if err != nil {
+		return
+	}
 	lc, err := ldapConnect()
 	if err != nil {
 		return
 	}
+	if ldapDryRun {
+		plan, e := planClearLdapTns(lc, contextDN, ldapFlagKeepOptions())
+		if e != nil {
+			err = fmt.Errorf("clear plan failed: %v", e)
+			return
+		}
+		err = writeLdapPlan(os.Stdout, plan)
+		return
+	}
+	if _, err = backupLdapTns(lc, contextDN); err != nil {
+		return
+	}
 	o, f := ClearLdapTns(lc, contextDN)
 	log.Infof("SUCCESS: '%d' Entries deleted, %d  failed\n", o, f)
 	if f == 0 {
@@ -316,226 +470,445 @@ func ldapClear() (err error) {
 
 // ClearLdapTns deletes all oraclenet entries below given context
 func ClearLdapTns(lc *ldaplib.LdapConfigType, contextDN string) (ok int, fail int) {
-	var err error
 	// counter
 	ok = 0
 	fail = 0
-	// verify OracleContext
-	if contextDN == "" {
-		log.Errorf("clearLdap:no OracleContext given")
-		fail = 1
-		return
-	}
-	log.Debugf("Use OracleContext DN %s", contextDN)
-	// load available ldap entries
-	ldapEntries, err := dblib.ReadLdapTns(lc, contextDN)
+	plan, err := planClearLdapTns(lc, contextDN, ldapFlagKeepOptions())
 	if err != nil {
-		log.Errorf("read failed:%s", err)
+		log.Errorf("clearLdap:%s", err)
 		fail = 1
 		return
 	}
-	if len(ldapEntries) == 0 {
+	if len(plan) == 0 {
 		log.Warnf("no entries found in Context %s", contextDN)
 		return
 	}
 
 	// loop
-	for _, e := range ldapEntries {
-		dn := e.Location
-		alias := e.Name
-		// check dn
-		if dn != "" && strings.HasPrefix(dn, "cn=") {
-			err = dblib.DeleteLdapTNSEntry(lc, dn, alias)
+	for _, item := range plan {
+		switch {
+		case item.Action == sSkip:
+			fail++
+		case item.Action == sKeep:
+			log.Infof("Ldap Alias %s protected, not deleted", item.Alias)
+		case ldapDryRun:
+			ok++
+		default:
+			if item.AliasOf != "" {
+				err = handleAliasObject(lc, item)
+			} else {
+				err = dblib.DeleteLdapTNSEntry(lc, item.DN, item.Alias)
+			}
 			if err != nil {
-				log.Warnf("Cannot delete alias %s: %s", alias, err)
+				log.Warnf("Cannot delete alias %s: %s", item.Alias, err)
 				fail++
 			} else {
 				ok++
-				log.Infof("Ldap Alias %s deleted", alias)
+				log.Infof("Ldap Alias %s deleted", item.Alias)
 			}
-		} else {
-			log.Warnf("Cannot delete alias %s with invalid dn '%s'", alias, dn)
-			fail++
 		}
 	}
 	return
 }
 
-// WriteLdapTns writes a set of TNS entries to Ldap
-func WriteLdapTns(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, domain string, contextDN string) (TWorkStatus, error) {
-	workStatus := make(TWorkStatus)
-	workStatus[sOK] = 0
-	workStatus[sMod] = 0
-	workStatus[sNew] = 0
-	workStatus[sDel] = 0
-	workStatus[sSkip] = 0
+// planClearLdapTns lists the entries ClearLdapTns would delete
+func planClearLdapTns(lc *ldaplib.LdapConfigType, contextDN string, keep ldapKeepOptions) (plan []ldapPlanItem, err error) {
+	// verify OracleContext
+	if contextDN == "" {
+		err = fmt.Errorf("no OracleContext given")
+		return
+	}
+	log.Debugf("Use OracleContext DN %s", contextDN)
+	// load available ldap entries
+	ldapEntries, err := dblib.ReadLdapTns(lc, contextDN)
+	if err != nil {
+		err = fmt.Errorf("read failed:%s", err)
+		return
+	}
+	for _, alias := range getSortedAliases(ldapEntries) {
+		e := ldapEntries[alias]
+		item := ldapPlanItem{Alias: e.Name, Action: sDel, DN: e.Location}
+		// check dn
+		if e.Location == "" || !strings.HasPrefix(e.Location, "cn=") {
+			log.Warnf("Cannot delete alias %s with invalid dn '%s'", e.Name, e.Location)
+			item.Action = sSkip
+		}
+		plan = append(plan, keepAlias(item, keep))
+	}
+	// alias objects go first, so none of them is left dangling
+	aliases, err := readLdapAliases(lc, contextDN)
+	if err != nil {
+		return
+	}
+	aliasPlan := make([]ldapPlanItem, 0, len(aliases))
+	for _, a := range aliases {
+		aliasPlan = append(aliasPlan, keepAlias(ldapPlanItem{Alias: a.Name, Action: sDel, DN: a.DN, AliasOf: a.Target}, keep))
+	}
+	plan = append(aliasPlan, plan...)
+	return
+}
 
+// WriteLdapTns writes a set of TNS entries to Ldap. With --dry-run only the counts are returned
+func WriteLdapTns(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, domain string, contextDN string) (TWorkStatus, error) {
 	log.Infof("Update LDAP Context %s with %d tnsnames.ora entries using domain %s", contextDN, len(tnsEntries), domain)
-	ldapTNS, ldapstatus, err := buildStatusMap(lc, tnsEntries, contextDN)
-	if err != nil {
+	plan, workStatus, err := planLdapTns(lc, tnsEntries, domain, contextDN, ldapFlagKeepOptions())
+	if err != nil || ldapDryRun {
 		return workStatus, err
 	}
+	return applyLdapPlan(lc, contextDN, plan)
+}
 
-	sortedAlias := getSortedAliases(ldapstatus)
-	tnsLow := getLowercaseTNS(tnsEntries)
+// applyLdapPlan executes all planned operations and returns the work status.
+// With --atomic the first failed operation rolls back all changes already applied
+func applyLdapPlan(lc *ldaplib.LdapConfigType, contextDN string, plan []ldapPlanItem) (workStatus TWorkStatus, err error) {
+	workStatus = newWorkStatus()
+	var journal []ldapPlanItem
+	for _, item := range plan {
+		e := applyPlanItem(lc, contextDN, item, workStatus)
+		if e == nil {
+			journal = append(journal, item)
+			continue
+		}
+		log.Warnf("Error processing alias %s: %v", item.Alias, e)
+		if ldapAtomic {
+			err = rollbackLdapPlan(lc, contextDN, journal, item, e)
+			return
+		}
+	}
 
+	log.Infof("%d TNS entries unchanged,%d new written, %d modified, %d deleted, %d kept and %d skipped because of errors",
+		workStatus[sOK], workStatus[sNew], workStatus[sMod], workStatus[sDel], workStatus[sKeep], workStatus[sSkip])
+	return
+}
+
+// planLdapTns computes the operations needed to sync LDAP with the given entries
+// and the expected work status without changing anything. Aliases are mapped with
+// the configured alias mode, domain is the default domain of the entries
+func planLdapTns(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, domain string, contextDN string, keep ldapKeepOptions) (plan []ldapPlanItem, workStatus TWorkStatus, err error) {
+	key, err := aliasKey(domain)
+	if err != nil {
+		return
+	}
+	return planLdapSync(lc, tnsEntries, contextDN, key, keep)
+}
+
+// planLdapSync plans the sync of the entries, key maps an entry name to its LDAP alias
+// and keep decides which changes are not applied
+func planLdapSync(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, contextDN string, key func(string) string, keep ldapKeepOptions) (plan []ldapPlanItem, workStatus TWorkStatus, err error) {
+	workStatus = newWorkStatus()
+	ldapTNS, ldapstatus, err := buildStatusMap(lc, tnsEntries, contextDN, key)
+	if err != nil {
+		return
+	}
+
+	sortedAlias := getSortedAliases(ldapstatus)
+	tnsLow := getLowercaseTNS(tnsEntries, key)
 	for _, alias := range sortedAlias {
-		err = processAlias(lc, contextDN, alias, ldapstatus[alias], ldapTNS, tnsLow, workStatus)
-		if err != nil {
-			log.Warnf("Error processing alias %s: %v", alias, err)
-		}
+		item := keepAlias(planAlias(contextDN, alias, ldapstatus[alias], ldapTNS, tnsLow, key), keep)
+		workStatus[item.Action]++
+		plan = append(plan, item)
+	}
+	return
+}
+
+func newWorkStatus() TWorkStatus {
+	return TWorkStatus{sOK: 0, sMod: 0, sNew: 0, sDel: 0, sSkip: 0, sKeep: 0}
+}
+
+// protectRegex compiles the --protect expression, empty protects nothing
+func protectRegex(expr string) (re *regexp.Regexp, err error) {
+	if expr == "" {
+		return
+	}
+	re, err = regexp.Compile(expr)
+	if err != nil {
+		err = fmt.Errorf("invalid protect regex '%s': %v", expr, err)
 	}
+	return
+}
 
-	log.Infof("%d TNS entries unchanged,%d new written, %d modified, %d deleted and %d skipped because of errors",
-		workStatus[sOK], workStatus[sNew], workStatus[sMod], workStatus[sDel], workStatus[sSkip])
-	return workStatus, nil
+// ldapFlagKeepOptions returns the keep options set by --no-delete and --protect
+func ldapFlagKeepOptions() ldapKeepOptions {
+	return ldapKeepOptions{noDelete: ldapNoDelete, protect: ldapProtectRe}
 }
 
-func getSortedAliases(ldapstatus map[string]string) []string {
-	sortedAlias := make([]string, 0, len(ldapstatus))
-	for k := range ldapstatus {
+// keepAlias turns deletions with noDelete and all changes of protected aliases into sKeep
+func keepAlias(item ldapPlanItem, keep ldapKeepOptions) ldapPlanItem {
+	switch item.Action {
+	case sNew, sMod, sDel:
+	default:
+		return item
+	}
+	switch {
+	case keep.protect != nil && keep.protect.MatchString(item.Alias):
+		log.Debugf("Alias %s is protected, keep it ->KEEP", item.Alias)
+	case item.Action == sDel && keep.noDelete:
+		log.Debugf("Alias %s missed in TNS, but deletions are disabled ->KEEP", item.Alias)
+	default:
+		return item
+	}
+	item.Action = sKeep
+	item.Changes = nil
+	return item
+}
+
+func getSortedAliases[V any](m map[string]V) []string {
+	sortedAlias := make([]string, 0, len(m))
+	for k := range m {
 		sortedAlias = append(sortedAlias, k)
 	}
 	sort.Strings(sortedAlias)
 	return sortedAlias
 }
 
-func getLowercaseTNS(tnsEntries dblib.TNSEntries) dblib.TNSEntries {
+func getLowercaseTNS(tnsEntries dblib.TNSEntries, key func(string) string) dblib.TNSEntries {
 	tnsLow := make(dblib.TNSEntries, len(tnsEntries))
 	for _, v := range tnsEntries {
-		n := dropRe.ReplaceAllString(strings.ToLower(v.Name), "")
-		tnsLow[strings.ToLower(n)] = v
+		tnsLow[key(v.Name)] = v
 	}
 	return tnsLow
 }
 
-func processAlias(lc *ldaplib.LdapConfigType, contextDN, alias, status string, ldapTNS, tnsLow dblib.TNSEntries, workStatus TWorkStatus) error {
-	shortAlias := dropRe.ReplaceAllString(strings.ToLower(alias), "")
+// planAlias decides what to do with one alias of the status map
+func planAlias(contextDN, alias, status string, ldapTNS, tnsLow dblib.TNSEntries, key func(string) string) (item ldapPlanItem) {
+	short := key(alias)
+	item = ldapPlanItem{Alias: alias, Action: status}
 
 	switch status {
 	case sOK:
-		log.Debugf("Alias %s unchanged", alias)
-		workStatus[sOK]++
-		return nil
+		item.DN = ldapTNS[alias].Location
 
 	case sNew:
-		return handleNewAlias(lc, contextDN, shortAlias, tnsLow, workStatus)
+		item.Alias = short
+		tnsEntry, valid := tnsLow[short]
+		if !valid {
+			log.Warnf("Skip add invalid tns alias %s", short)
+			item.Action = sSkip
+			return
+		}
+		item.DN = serviceDN(short, contextDN)
+		item.desc = tnsEntry.Desc
 
 	case sMod:
-		return handleModifiedAlias(lc, shortAlias, alias, ldapTNS, tnsLow, workStatus)
+		item.Alias = short
+		ldapEntry, valid := ldapTNS[alias]
+		if !valid {
+			log.Warnf("Skip modify invalid ldap alias %s", alias)
+			item.Action = sSkip
+			return
+		}
+		tnsEntry, valid := tnsLow[short]
+		if !valid {
+			log.Warnf("Skip modify invalid tns alias %s", alias)
+			item.Action = sSkip
+			return
+		}
+		item.DN = ldapEntry.Location
+		item.desc = tnsEntry.Desc
+		item.prev = ldapEntry.Desc
+		item.Changes = descChanges(ldapEntry.Desc, tnsEntry.Desc)
 
 	case "":
-		return handleDeletedAlias(lc, alias, ldapTNS, workStatus)
+		item.Action = sDel
+		ldapEntry, valid := ldapTNS[alias]
+		if !valid {
+			log.Warnf("Skip delete invalid ldap alias %s", alias)
+			item.Action = sSkip
+			return
+		}
+		item.DN = ldapEntry.Location
+		item.prev = ldapEntry.Desc
 	}
-
-	return nil
+	return
 }
 
-func handleNewAlias(lc *ldaplib.LdapConfigType, contextDN, shortAlias string, tnsLow dblib.TNSEntries, workStatus TWorkStatus) error {
-	tnsEntry, valid := tnsLow[shortAlias]
-	if !valid {
-		log.Warnf("Skip add invalid tns alias %s", shortAlias)
+// applyPlanItem executes one planned operation and counts the result
+func applyPlanItem(lc *ldaplib.LdapConfigType, contextDN string, item ldapPlanItem, workStatus TWorkStatus) error {
+	switch {
+	case item.Action == sOK:
+		log.Debugf("Alias %s unchanged", item.Alias)
+		workStatus[sOK]++
+	case item.Action == sKeep:
+		log.Infof("Alias %s kept", item.Alias)
+		workStatus[sKeep]++
+	case item.Action == sSkip:
 		workStatus[sSkip]++
-		return nil
+	case item.AliasOf != "":
+		return handleAliasItem(lc, item, workStatus)
+	case item.Action == sNew:
+		return handleNewAlias(lc, contextDN, item, workStatus)
+	case item.Action == sMod:
+		return handleModifiedAlias(lc, item, workStatus)
+	case item.Action == sDel:
+		return handleDeletedAlias(lc, item, workStatus)
 	}
+	return nil
+}
 
-	err := dblib.AddLdapTNSEntry(lc, contextDN, shortAlias, tnsEntry.Desc)
+func handleAliasItem(lc *ldaplib.LdapConfigType, item ldapPlanItem, workStatus TWorkStatus) error {
+	err := handleAliasObject(lc, item)
 	if err != nil {
-		log.Warnf("Add %s failed: %v", shortAlias, err)
+		log.Warnf("%s alias object %s failed: %v", item.Action, item.Alias, err)
 		workStatus[sSkip]++
 		return err
 	}
-
-	workStatus[sNew]++
-	log.Infof("Alias %s added", shortAlias)
+	log.Infof("Alias object %s %s", item.Alias, map[string]string{sNew: "added", sMod: "modified", sDel: "deleted"}[item.Action])
+	workStatus[item.Action]++
 	return nil
 }
 
-func handleModifiedAlias(lc *ldaplib.LdapConfigType, shortAlias, alias string, ldapTNS, tnsLow dblib.TNSEntries, workStatus TWorkStatus) error {
-	ldapEntry, valid := ldapTNS[alias]
-	if !valid {
-		log.Warnf("Skip modify invalid ldap alias %s", alias)
+func handleNewAlias(lc *ldaplib.LdapConfigType, contextDN string, item ldapPlanItem, workStatus TWorkStatus) error {
+	err := dblib.AddLdapTNSEntry(lc, contextDN, item.Alias, item.desc)
+	if err != nil {
+		log.Warnf("Add %s failed: %v", item.Alias, err)
 		workStatus[sSkip]++
-		return nil
+		return err
 	}
 
-	tnsEntry, valid := tnsLow[shortAlias]
-	if !valid {
-		log.Warnf("Skip modify invalid tns alias %s", alias)
-		workStatus[sSkip]++
-		return nil
-	}
+	workStatus[sNew]++
+	log.Infof("Alias %s added", item.Alias)
+	return nil
+}
 
-	err := dblib.ModifyLdapTNSEntry(lc, ldapEntry.Location, shortAlias, tnsEntry.Desc)
+func handleModifiedAlias(lc *ldaplib.LdapConfigType, item ldapPlanItem, workStatus TWorkStatus) error {
+	err := dblib.ModifyLdapTNSEntry(lc, item.DN, item.Alias, item.desc)
 	if err != nil {
-		log.Warnf("Modify %s failed: %v", shortAlias, err)
+		log.Warnf("Modify %s failed: %v", item.Alias, err)
 		workStatus[sSkip]++
 		return err
 	}
 
-	log.Infof("Alias %s modified", shortAlias)
+	log.Infof("Alias %s modified", item.Alias)
 	workStatus[sMod]++
 	return nil
 }
 
-func handleDeletedAlias(lc *ldaplib.LdapConfigType, alias string, ldapTNS dblib.TNSEntries, workStatus TWorkStatus) error {
-	ldapEntry, valid := ldapTNS[alias]
-	if !valid {
-		log.Warnf("Skip delete invalid ldap alias %s", alias)
-		workStatus[sSkip]++
-		return nil
-	}
-
-	err := dblib.DeleteLdapTNSEntry(lc, ldapEntry.Location, alias)
+func handleDeletedAlias(lc *ldaplib.LdapConfigType, item ldapPlanItem, workStatus TWorkStatus) error {
+	err := dblib.DeleteLdapTNSEntry(lc, item.DN, item.Alias)
 	if err != nil {
-		log.Warnf("Delete %s failed: %v", alias, err)
+		log.Warnf("Delete %s failed: %v", item.Alias, err)
 		workStatus[sSkip]++
 		return err
 	}
 
-	log.Infof("Alias %s deleted", alias)
+	log.Infof("Alias %s deleted", item.Alias)
 	workStatus[sDel]++
 	return nil
 }
 
+// rollbackLdapPlan undoes the applied operations in reverse order and returns an error
+// naming the failed operation, the rolled back operations and failed undos
+func rollbackLdapPlan(lc *ldaplib.LdapConfigType, contextDN string, journal []ldapPlanItem, failed ldapPlanItem, cause error) error {
+	var undone, broken []string
+	for i := len(journal) - 1; i >= 0; i-- {
+		item := journal[i]
+		switch item.Action {
+		case sNew, sMod, sDel:
+		default:
+			continue
+		}
+		log.Infof("Rollback %s %s", item.Action, item.Alias)
+		err := applyPlanItem(lc, contextDN, undoPlanItem(item), newWorkStatus())
+		if err != nil {
+			broken = append(broken, fmt.Sprintf("%s %s (%v)", item.Action, item.Alias, err))
+			continue
+		}
+		undone = append(undone, item.Action+" "+item.Alias)
+	}
+	msg := fmt.Sprintf("%s %s failed: %v", failed.Action, failed.Alias, cause)
+	if len(undone) == 0 {
+		msg += ", nothing to roll back"
+	} else {
+		msg += ", rolled back: " + strings.Join(undone, ", ")
+	}
+	if len(broken) > 0 {
+		msg += ", rollback failed: " + strings.Join(broken, ", ")
+	}
+	log.Error(msg)
+	return fmt.Errorf("atomic write aborted, %s", msg)
+}
+
+// undoPlanItem returns the operation restoring the state before item
+func undoPlanItem(item ldapPlanItem) ldapPlanItem {
+	undo := ldapPlanItem{Alias: item.Alias, DN: item.DN, AliasOf: item.AliasOf, desc: item.prev, prev: item.desc}
+	switch item.Action {
+	case sNew:
+		undo.Action = sDel
+	case sDel:
+		undo.Action = sNew
+	case sMod:
+		undo.Action = sMod
+		if item.AliasOf != "" {
+			undo.AliasOf = item.prev
+			undo.prev = item.AliasOf
+		}
+	}
+	return undo
+}
+
+// writeLdapPlan prints the planned operations with descriptor changes and a summary
+func writeLdapPlan(w io.Writer, plan []ldapPlanItem) (err error) {
+	var sb strings.Builder
+	counts := newWorkStatus()
+	for _, item := range plan {
+		counts[item.Action]++
+		fmt.Fprintf(&sb, "%-4s %s %s\n", item.Action, item.Alias, item.DN)
+		for _, c := range item.Changes {
+			p := c.Path
+			if p == "" {
+				p = "descriptor"
+			}
+			fmt.Fprintf(&sb, "     %s: %s -> %s\n", p, diffValue(c.Old), diffValue(c.New))
+		}
+	}
+	fmt.Fprintf(&sb, "Plan: %d new, %d mod, %d del, %d ok, %d keep, %d skip. Dry run, nothing changed\n",
+		counts[sNew], counts[sMod], counts[sDel], counts[sOK], counts[sKeep], counts[sSkip])
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
 // buildstatus creates ops task map to handle
-func buildStatusMap(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, contextDN string) (dblib.TNSEntries, map[string]string, error) {
-	var alias string
+func buildStatusMap(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, contextDN string, key func(string) string) (dblib.TNSEntries, map[string]string, error) {
 	ldapstatus := map[string]string{}
 
+	// different entries must not overwrite each other in LDAP
+	if err := checkAliasCollisions(tnsEntries, key); err != nil {
+		return nil, ldapstatus, err
+	}
 	ldapTNS, err := dblib.ReadLdapTns(lc, contextDN)
 	if err != nil {
 		return nil, ldapstatus, err
 	}
-	for _, a := range ldapTNS {
-		alias = a.Name
-		ldapstatus[alias] = ""
-		log.Debugf("prepare status for LDAP Alias  %s", alias)
-	}
-
-	for _, t := range tnsEntries {
-		// strip domain from alias, only short ldap alias required
-		alias = t.Name
-		shortAlias := dropRe.ReplaceAllString(strings.ToLower(alias), "")
-
-		l, valid := ldapTNS[shortAlias]
-		if valid {
-			comp := strings.Compare(l.Desc, t.Desc)
-			if comp == 0 {
-				ldapstatus[shortAlias] = sOK
-				log.Debugf("TNS Alias %s exists in LDAP and is equal ->OK", alias)
-				continue
-			}
-			ldapstatus[shortAlias] = sMod
-			log.Debugf("TNS Alias %s exists in LDAP, but description changed ->MOD", alias)
-		} else {
-			ldapstatus[alias] = sNew
-			log.Debugf("TNS Alias %s missed in LDAP ->NEW", alias)
+	// map file aliases to ldap aliases
+	for _, d := range diffTNS(ldapTNS, tnsEntries, ldapKey, key, descEqual) {
+		switch d.Status {
+		case sDel:
+			ldapstatus[d.key] = ""
+			log.Debugf("LDAP Alias %s missed in TNS ->DEL", d.key)
+		case sNew:
+			ldapstatus[d.toEntry.Name] = sNew
+			log.Debugf("TNS Alias %s missed in LDAP ->NEW", d.toEntry.Name)
+		case sOK:
+			ldapstatus[d.key] = sOK
+			log.Debugf("TNS Alias %s exists in LDAP and is equal ->OK", d.toEntry.Name)
+		case sMod:
+			ldapstatus[d.key] = sMod
+			log.Debugf("TNS Alias %s exists in LDAP, but description changed ->MOD", d.toEntry.Name)
 		}
 	}
 	return ldapTNS, ldapstatus, err
 }
 
+// shortAlias returns the LDAP alias name for a tnsnames.ora alias
+func shortAlias(alias string) string {
+	return dropRe.ReplaceAllString(strings.ToLower(alias), "")
+}
+
+// ldapKey returns the alias of an LDAP entry as stored
+func ldapKey(alias string) string {
+	return alias
+}
+
 func promptPassword(label string) (pw string, err error) {
 	prompt := promptui.Prompt{
 		Label: label,
@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/tommi2day/tnscli/test"
 
 	"github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -86,6 +89,8 @@ func TestOracleLdap(t *testing.T) {
 	require.NoErrorf(t, err, "ChDir failed")
 	ldapAdmin := test.TestData
 	tnsAdmin = test.TestData
+	// keep snapshots of the commands below out of the user cache dir
+	ldapBackupDir = t.TempDir()
 	testConfig := path.Join(test.TestDir, "tnscli.yaml")
 	tnsSource1 := path.Join(tnsAdmin, "/ldap_file_write1.ora")
 	tnsSource2 := path.Join(tnsAdmin, "/ldap_file_write2.ora")
@@ -125,6 +130,26 @@ func TestOracleLdap(t *testing.T) {
 		assert.Equal(t, "localhost", lc.Server, "Host not as expected")
 		assert.Equal(t, false, lc.TLS, "TLS flag not as expected")
 	})
+	t.Run("Ldap status", func(t *testing.T) {
+		contextDN = ""
+		args := []string{
+			cmdLdap,
+			"status",
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.binddn", LdapAdminUser,
+			"--ldap.bindpassword", LdapAdminPassword,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapServer = ""
+		ldapPort = 0
+		require.NoErrorf(t, err, "Command returned error: %s", err)
+		t.Log(out)
+		assert.Contains(t, out, "cn=OracleContext,"+LdapBaseDn, "Context not found")
+		assert.Contains(t, out, "healthy", "healthy server expected")
+		assert.Contains(t, out, sourceLdapOra, "ldap.ora servers should be probed")
+	})
 	base := LdapBaseDn
 	lc := ldaplib.NewConfig(server, port, false, false, base, ldapTimeout)
 	context := ""
@@ -180,6 +205,53 @@ func TestOracleLdap(t *testing.T) {
 		return
 	}
 
+	t.Run("Plan Ldap function", func(t *testing.T) {
+		planEntries, _, err := dblib.GetTnsnames(tnsSource2, true)
+		require.NoErrorf(t, err, "Parsing %s failed: %s", tnsSource2, err)
+		ldapDryRun = true
+		workstatus, err := WriteLdapTns(lc, planEntries, "", context)
+		ldapDryRun = false
+		require.NoErrorf(t, err, "Plan TNS to Ldap failed: %s", err)
+		assert.Equal(t, 1, workstatus[sOK], "One OK expected")
+		assert.Equal(t, 1, workstatus[sNew], "One Adds expected")
+		assert.Equal(t, 1, workstatus[sMod], "One mod expected")
+		assert.Equal(t, 1, workstatus[sDel], "One del expected")
+		ldapEntries, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		assert.Equal(t, 3, len(ldapEntries), "dry run should not change LDAP")
+	})
+	t.Run("Plan Ldap with no-delete and protect", func(t *testing.T) {
+		planEntries, _, err := dblib.GetTnsnames(tnsSource2, true)
+		require.NoErrorf(t, err, "Parsing %s failed: %s", tnsSource2, err)
+		ldapDryRun = true
+		ldapNoDelete = true
+		ldapProtectRe = regexp.MustCompile("^xe1$")
+		workstatus, err := WriteLdapTns(lc, planEntries, "", context)
+		ldapDryRun = false
+		ldapNoDelete = false
+		ldapProtectRe = nil
+		require.NoErrorf(t, err, "Plan TNS to Ldap failed: %s", err)
+		assert.Equal(t, 1, workstatus[sOK], "One OK expected")
+		assert.Equal(t, 1, workstatus[sNew], "One Adds expected")
+		assert.Equal(t, 0, workstatus[sMod], "protected alias should not be modified")
+		assert.Equal(t, 0, workstatus[sDel], "no del expected")
+		assert.Equal(t, 2, workstatus[sKeep], "Two keep expected")
+	})
+	t.Run("Plan Ldap with alias collision", func(t *testing.T) {
+		collide := dblib.TNSEntries{
+			"DB.PROD.example": {Name: "DB.PROD.example", Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=prod)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=DB)))"},
+			"DB.TEST.example": {Name: "DB.TEST.example", Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=test)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=DB)))"},
+		}
+		_, err := WriteLdapTns(lc, collide, "example", context)
+		assert.ErrorContains(t, err, "db <- DB.PROD.example, DB.TEST.example", "collision should be reported")
+		ldapAliasMode = aliasModeDomain
+		ldapDryRun = true
+		workstatus, err := WriteLdapTns(lc, collide, "example", context)
+		ldapDryRun = false
+		ldapAliasMode = ""
+		require.NoErrorf(t, err, "Plan with domain aliases failed: %s", err)
+		assert.Equal(t, 2, workstatus[sNew], "Two adds expected")
+	})
 	t.Run("Modify Ldap function", func(t *testing.T) {
 		err = os.Chdir(test.TestDir)
 		require.NoErrorf(t, err, "ChDir failed")
@@ -208,10 +280,148 @@ func TestOracleLdap(t *testing.T) {
 		assert.Equal(t, 1, d, "One del expected")
 		assert.Equal(t, 0, s, "No skip expected")
 	})
+	t.Run("Atomic write rollback", func(t *testing.T) {
+		before, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		plan := []ldapPlanItem{
+			{Alias: "atomic", Action: sNew, DN: "cn=atomic," + context, desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=ATOMIC)))"},
+			{Alias: "missing", Action: sMod, DN: "cn=missing," + context, desc: "(DESCRIPTION=(CONNECT_DATA=(SERVICE_NAME=MISSING)))"},
+		}
+		ldapAtomic = true
+		_, err = applyLdapPlan(lc, context, plan)
+		ldapAtomic = false
+		require.Error(t, err, "failed modify should abort")
+		t.Log(err)
+		assert.ErrorContains(t, err, "mod missing failed")
+		assert.ErrorContains(t, err, "rolled back: new atomic")
+		after, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		assert.Equal(t, before, after, "LDAP should be unchanged after rollback")
+	})
+	t.Run("Backup and Restore Ldap function", func(t *testing.T) {
+		dir := ldapBackupDir
+		ldapBackupDir = path.Join(tnsAdmin, "ldap_backup")
+		defer func() {
+			_ = os.RemoveAll(ldapBackupDir)
+			ldapBackupDir = dir
+		}()
+		before, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		target := getSortedAliases(before)[0]
+		alias := ldapPlanItem{Alias: "snapalias", Action: sNew, DN: "cn=snapalias," + context, AliasOf: before[target].Location}
+		err = handleAliasObject(lc, alias)
+		require.NoErrorf(t, err, "Add alias object failed: %s", err)
+		file, err := backupLdapTns(lc, context)
+		require.NoErrorf(t, err, "Backup failed: %s", err)
+		require.FileExists(t, file, "Snapshot not created")
+		_, f := ClearLdapTns(lc, context)
+		require.Equalf(t, 0, f, "Clearing TNS Ldap had %d failures", f)
+		aliases, err := readLdapAliases(lc, context)
+		require.NoErrorf(t, err, "Read aliases failed: %s", err)
+		require.Empty(t, aliases, "clear should delete the alias object")
+		content, err := os.ReadFile(file)
+		require.NoErrorf(t, err, "Snapshot not readable: %s", err)
+		snapshot, snapshotAliases, err := readLdifRecords(string(content))
+		require.NoErrorf(t, err, "Snapshot not parsable: %s", err)
+		require.Len(t, snapshotAliases, 1, "alias object should be in the snapshot")
+		workstatus, err := RestoreLdapTns(lc, snapshot, snapshotAliases, context)
+		require.NoErrorf(t, err, "Restore failed: %s", err)
+		assert.Equal(t, len(before)+1, workstatus[sNew], "all entries and the alias object should be added again")
+		after, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		require.Equal(t, len(before), len(after), "restored entry count not expected")
+		for k, e := range before {
+			assert.Equalf(t, e.Desc, after[k].Desc, "descriptor of %s not restored", k)
+		}
+		aliases, err = readLdapAliases(lc, context)
+		require.NoErrorf(t, err, "Read aliases failed: %s", err)
+		require.Len(t, aliases, 1, "alias object should be restored")
+		assert.Equal(t, "snapalias", aliases[0].Name)
+		assert.Equal(t, dnKey(before[target].Location), dnKey(aliases[0].Target), "alias target not restored")
+		// later tests expect net services only
+		alias.Action = sDel
+		err = handleAliasObject(lc, alias)
+		require.NoErrorf(t, err, "Delete alias object failed: %s", err)
+	})
+	t.Run("Clear Ldap dry run", func(t *testing.T) {
+		ldapDryRun = true
+		o, f := ClearLdapTns(lc, context)
+		ldapDryRun = false
+		assert.Equal(t, 3, o, "3 entries to delete expected")
+		assert.Equal(t, 0, f, "no failures expected")
+		ldapEntries, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		assert.Equal(t, 3, len(ldapEntries), "dry run should not change LDAP")
+	})
 	t.Run("Clear Ldap function", func(t *testing.T) {
 		_, f := ClearLdapTns(lc, context)
 		require.Equalf(t, 0, f, "Clearing TNS Ldap had %d failures", f)
 	})
+	t.Run("Read alias objects only", func(t *testing.T) {
+		alias := ldapPlanItem{Alias: "lonely", Action: sNew, DN: "cn=lonely," + context, AliasOf: "cn=gone," + context}
+		err = handleAliasObject(lc, alias)
+		require.NoErrorf(t, err, "Add alias object failed: %s", err)
+		defer func() {
+			alias.Action = sDel
+			_ = handleAliasObject(lc, alias)
+		}()
+		contextDN, ldapReadFormat = context, formatLdif
+		defer func() { contextDN, ldapReadFormat = "", formatTNS }()
+		var sb strings.Builder
+		n, err := renderLdapTns(lc, &sb)
+		require.NoErrorf(t, err, "render failed: %s", err)
+		assert.Equal(t, 1, n, "alias object should be counted")
+		assert.Contains(t, sb.String(), "aliasedObjectName: cn=gone,"+context, "alias object should be rendered")
+	})
+	t.Run("Write TNS to Ldap dry run", func(t *testing.T) {
+		args := []string{
+			cmdLdap,
+			"write",
+			"--ldap.oraclectx", LdapBaseDn,
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.base", LdapBaseDn,
+			"--ldap.binddn", LdapAdminUser,
+			"--ldap.bindpassword", LdapAdminPassword,
+			"--ldap.tnssource", tnsSource1,
+			"--dry-run",
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapDryRun = false
+		require.NoErrorf(t, err, "Command returned error: %s", err)
+		t.Log(out)
+		assert.Containsf(t, out, "new  xe ", "Output not as expected")
+	})
+	t.Run("Write TNS to Ldap LDIF changes", func(t *testing.T) {
+		ldifFile := path.Join(tnsAdmin, "ldap_write.ldif")
+		_ = os.Remove(ldifFile)
+		args := []string{
+			cmdLdap,
+			"write",
+			"--ldap.oraclectx", LdapBaseDn,
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.base", LdapBaseDn,
+			"--ldap.binddn", LdapAdminUser,
+			"--ldap.bindpassword", LdapAdminPassword,
+			"--ldap.tnssource", tnsSource1,
+			"--ldif-out", ldifFile,
+			"--dry-run",
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapDryRun = false
+		ldapLdifOut = ""
+		require.NoErrorf(t, err, "Command returned error: %s", err)
+		c, err := os.ReadFile(ldifFile)
+		require.NoErrorf(t, err, "LDIF file not readable: %s", err)
+		content := string(c)
+		t.Log(content)
+		assert.Containsf(t, content, "dn: cn=xe,cn=OracleContext,"+LdapBaseDn+"\nchangetype: add\n", "LDIF not as expected")
+		assert.Equal(t, 3, strings.Count(content, "changetype: add"), "3 adds expected")
+		assert.Containsf(t, out, "Plan: 3 new, 0 mod, 0 del, 0 ok, 0 keep, 0 skip", "Output not as expected")
+	})
 	t.Run("Write TNS to Ldap", func(t *testing.T) {
 		args := []string{
 			cmdLdap,
@@ -232,6 +442,96 @@ func TestOracleLdap(t *testing.T) {
 		assert.Containsf(t, out, "SUCCESS: ", "Output not as expected")
 	})
 
+	t.Run("Write TNS to Ldap targets dry run", func(t *testing.T) {
+		viper.Set("ldap.targets", []map[string]any{
+			{"name": "main", "context": "cn=OracleContext," + LdapBaseDn, "source": tnsSource2},
+			{"name": "missing", "context": "cn=OracleContext,dc=missing,dc=local"},
+		})
+		ldapCmd.PersistentFlags().Lookup("ldap.oraclectx").Changed = false
+		defer viper.Set("ldap.targets", nil)
+		args := []string{
+			cmdLdap,
+			"write",
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.base", LdapBaseDn,
+			"--ldap.binddn", LdapAdminUser,
+			"--ldap.bindpassword", LdapAdminPassword,
+			"--continue-on-error",
+			"--dry-run",
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapDryRun = false
+		ldapContinueOnError = false
+		t.Log(out)
+		assert.ErrorContains(t, err, "1 of 2 ldap targets failed")
+		assert.Contains(t, out, "main cn=OracleContext,"+LdapBaseDn+": 1 ok, 1 new, 1 mod, 1 del, 0 keep, 0 skip")
+		assert.Contains(t, out, "missing cn=OracleContext,dc=missing,dc=local: failed:")
+	})
+	t.Run("Write TNS aliases to Ldap", func(t *testing.T) {
+		aliasFile := path.Join(tnsAdmin, "ldap_aliases.txt")
+		err = common.WriteStringToFile(aliasFile, "xe_ro, xe_report = XE.local\nxe_ro2 = xe_ro\n")
+		require.NoErrorf(t, err, "Create test %s failed", aliasFile)
+		defer func() { _ = os.Remove(aliasFile) }()
+		args := []string{
+			cmdLdap,
+			"write",
+			"--ldap.oraclectx", LdapBaseDn,
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.base", LdapBaseDn,
+			"--ldap.binddn", LdapAdminUser,
+			"--ldap.bindpassword", LdapAdminPassword,
+			"--ldap.tnssource", tnsSource1,
+			"--aliases", aliasFile,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapAliasFile = ""
+		require.NoErrorf(t, err, "Command returned error: %s", err)
+		aliases, err := readLdapAliases(lc, context)
+		require.NoErrorf(t, err, "Read aliases failed: %s", err)
+		assert.Equal(t, 3, len(aliases), "3 alias objects expected")
+		services, err := dblib.ReadLdapTns(lc, context)
+		require.NoErrorf(t, err, "Read Ldap failed: %s", err)
+		merged := mergeLdapAliases(services, aliases)
+		assert.Equal(t, services["xe"].Desc, merged["xe_ro2"].Desc, "alias of alias not resolved")
+	})
+	t.Run("Diff Ldap source keeps context", func(t *testing.T) {
+		saved := contextDN
+		contextDN = "cn=OracleContext,dc=other,dc=local"
+		s, err := loadTnsSource(ldapSource + ":" + context)
+		other := contextDN
+		contextDN = saved
+		require.NoErrorf(t, err, "Load Ldap source failed: %s", err)
+		assert.Equal(t, "cn=OracleContext,dc=other,dc=local", other, "global context changed")
+		assert.Equal(t, context, s.Context, "source context mismatch")
+		assert.Equal(t, ldapSource+":"+context, s.Name, "source name mismatch")
+		assert.Contains(t, s.Entries, "xe_ro2", "alias objects missing in source")
+	})
+	t.Run("Search Ldap entries", func(t *testing.T) {
+		args := []string{
+			cmdLdap,
+			"search",
+			"XE.*",
+			"--regex",
+			"--output", outputJSON,
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.binddn", LdapAdminUser,
+			"--ldap.bindpassword", LdapAdminPassword,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapSearchRegex = false
+		ldapSearchOutput = outputText
+		require.NoErrorf(t, err, "Command returned error:%s", err)
+		t.Log(out)
+		assert.Contains(t, out, `"dn": "cn=xe,cn=OracleContext,`+LdapBaseDn+`"`, "xe not found")
+		assert.Contains(t, out, `"creatorsName": "`+LdapAdminUser+`"`, "creator not found")
+		assert.Contains(t, out, `"aliasedObjectName"`, "alias object not found")
+	})
 	t.Run("Read TNS from Ldap with config file and env", func(t *testing.T) {
 		tnsAdmin = test.TestData
 		filename = tnsAdmin + "/ldap_file_read.ora"
@@ -253,6 +553,72 @@ func TestOracleLdap(t *testing.T) {
 		assert.FileExistsf(t, filename, "Output File not created")
 		assert.Containsf(t, out, "SUCCESS: ", "Output not as expected")
 	})
+	t.Run("Read TNS from Ldap as LDIF", func(t *testing.T) {
+		filename = tnsAdmin + "/ldap_file_read.ldif"
+		_ = os.Remove(filename)
+		args := []string{
+			cmdLdap,
+			"read",
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.tnstarget", filename,
+			"--format", formatLdif,
+			"--config", testConfig,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapReadFormat = formatTNS
+		require.NoErrorf(t, err, "Command returned error:%s", err)
+		c, err := os.ReadFile(filename)
+		require.NoErrorf(t, err, "LDIF file not readable: %s", err)
+		content := string(c)
+		t.Log(content)
+		assert.Containsf(t, content, "dn: cn=xe,cn=OracleContext,"+LdapBaseDn+"\nobjectClass: top\nobjectClass: orclNetService\ncn: xe\n", "LDIF not as expected")
+	})
+	t.Run("Read TNS from Ldap as generated split files", func(t *testing.T) {
+		filename = tnsAdmin + "/ldap_generated.ora"
+		_ = os.Remove(filename)
+		args := []string{
+			cmdLdap,
+			"read",
+			"--ldap.host", server,
+			"--ldap.port", fmt.Sprintf("%d", port),
+			"--ldap.tnstarget", filename,
+			"--format", formatOra,
+			"--group-by", "cn",
+			"--split",
+			"--config", testConfig,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		ldapReadFormat = formatTNS
+		tnsGroupBy = ""
+		tnsSplit = false
+		require.NoErrorf(t, err, "Command returned error:%s", err)
+		c, err := os.ReadFile(filename)
+		require.NoErrorf(t, err, "generated file not readable: %s", err)
+		content := string(c)
+		t.Log(content)
+		assert.Contains(t, content, "# source: cn=OracleContext,"+LdapBaseDn, "header not found")
+		assert.Contains(t, content, "IFILE = ", "IFILE lines expected")
+		c, err = os.ReadFile(tnsAdmin + "/ldap_generated_xe.ora")
+		require.NoErrorf(t, err, "fragment not readable: %s", err)
+		assert.Contains(t, string(c), "xe =\n  (DESCRIPTION =\n", "fragment not as expected")
+	})
+	t.Run("Watch Ldap poll", func(t *testing.T) {
+		target := tnsAdmin + "/ldap_watch.ora"
+		_ = os.Remove(target)
+		_ = os.Remove(target + ".bak")
+		w := &tnsWatcher{target: target, lc: lc}
+		changed, err := w.poll()
+		require.NoErrorf(t, err, "first poll failed: %s", err)
+		assert.True(t, changed, "first poll should write the target")
+		assert.FileExists(t, target, "target not written")
+		changed, err = w.poll()
+		require.NoErrorf(t, err, "second poll failed: %s", err)
+		assert.False(t, changed, "unchanged context should not be written")
+		assert.NoFileExists(t, target+".bak", "no backup expected")
+	})
 
 	t.Run("Clear TNS Entries from Ldap with config file prompt password", func(t *testing.T) {
 		_ = os.Setenv("LDAP_BIND_PASSWORD", "")
@@ -281,3 +647,70 @@ func TestOracleLdap(t *testing.T) {
 		_ = w.Close()
 	})
 }
+
+func TestLdapPlan(t *testing.T) {
+	ctx := "cn=OracleContext," + LdapBaseDn
+	ldapTNS := dblib.TNSEntries{
+		"xe1": {Name: "xe1", Location: "cn=xe1," + ctx, Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=XE1)))"},
+		"xe2": {Name: "xe2", Location: "cn=xe2," + ctx, Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=XE2)))"},
+	}
+	tnsLow := dblib.TNSEntries{
+		"xe1": {Name: "XE1.local", Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db2)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=XE1)))"},
+		"new": {Name: "NEW.local", Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=NEW)))"},
+	}
+	var plan []ldapPlanItem
+	t.Run("plan items", func(t *testing.T) {
+		for _, a := range []struct{ alias, status string }{{"NEW.local", sNew}, {"xe1", sMod}, {"xe2", ""}, {"missing", sNew}} {
+			plan = append(plan, planAlias(ctx, a.alias, a.status, ldapTNS, tnsLow, shortAlias))
+		}
+		require.Equal(t, 4, len(plan), "plan size not expected")
+		assert.Equal(t, ldapPlanItem{Alias: "new", Action: sNew, DN: "cn=new," + ctx, desc: tnsLow["new"].Desc}, plan[0], "new item not expected")
+		assert.Equal(t, sMod, plan[1].Action, "mod action not expected")
+		assert.Equal(t, []descChange{{Path: "DESCRIPTION/ADDRESS/HOST", Old: "db1", New: "db2"}}, plan[1].Changes, "mod changes not expected")
+		assert.Equal(t, sDel, plan[2].Action, "del action not expected")
+		assert.Equal(t, "cn=xe2,"+ctx, plan[2].DN, "del dn not expected")
+		assert.Equal(t, sSkip, plan[3].Action, "invalid alias should be skipped")
+	})
+	t.Run("keep aliases", func(t *testing.T) {
+		protect, _ := protectRegex("^xe1$")
+		keep := ldapKeepOptions{noDelete: true, protect: protect}
+		assert.Equal(t, sNew, keepAlias(plan[0], keep).Action, "new alias should be added")
+		kept := keepAlias(plan[1], keep)
+		assert.Equal(t, sKeep, kept.Action, "protected alias should be kept")
+		assert.Empty(t, kept.Changes, "kept alias should have no changes")
+		assert.Equal(t, sKeep, keepAlias(plan[2], keep).Action, "no-delete should keep alias")
+		assert.Equal(t, sSkip, keepAlias(plan[3], keep).Action, "skip should stay skip")
+		assert.Equal(t, sDel, keepAlias(plan[2], ldapKeepOptions{}).Action, "no options should keep the plan")
+		_, err := protectRegex("(")
+		assert.Error(t, err, "invalid protect regex should fail")
+	})
+	t.Run("write plan", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeLdapPlan(&sb, plan)
+		require.NoErrorf(t, err, "write plan failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "new  new cn=new,"+ctx+"\n")
+		assert.Contains(t, out, "mod  xe1 cn=xe1,"+ctx+"\n     DESCRIPTION/ADDRESS/HOST: db1 -> db2\n")
+		assert.Contains(t, out, "del  xe2 cn=xe2,"+ctx+"\n")
+		assert.Contains(t, out, "Plan: 1 new, 1 mod, 1 del, 0 ok, 0 keep, 1 skip")
+	})
+	t.Run("undo items", func(t *testing.T) {
+		assert.Equal(t, ldapPlanItem{Alias: "new", Action: sDel, DN: "cn=new," + ctx, prev: tnsLow["new"].Desc}, undoPlanItem(plan[0]), "new should be deleted")
+		undo := undoPlanItem(plan[1])
+		assert.Equal(t, sMod, undo.Action, "mod should be modified back")
+		assert.Equal(t, ldapTNS["xe1"].Desc, undo.desc, "old descriptor should be restored")
+		undo = undoPlanItem(plan[2])
+		assert.Equal(t, sNew, undo.Action, "del should be added back")
+		assert.Equal(t, ldapTNS["xe2"].Desc, undo.desc, "deleted descriptor should be restored")
+		alias := ldapPlanItem{Alias: "ro", Action: sMod, DN: "cn=ro," + ctx, AliasOf: "cn=xe2," + ctx, prev: "cn=xe1," + ctx}
+		undo = undoPlanItem(alias)
+		assert.Equal(t, "cn=xe1,"+ctx, undo.AliasOf, "old alias target should be restored")
+		assert.Equal(t, sNew, undoPlanItem(ldapPlanItem{Alias: "ro", Action: sDel, AliasOf: "cn=xe1," + ctx}).Action, "deleted alias object should be added back")
+	})
+	t.Run("rollback message", func(t *testing.T) {
+		journal := []ldapPlanItem{{Alias: "xe", Action: sOK}, {Alias: "xe3", Action: sKeep}}
+		err := rollbackLdapPlan(nil, ctx, journal, plan[1], fmt.Errorf("no such object"))
+		assert.EqualError(t, err, "atomic write aborted, mod xe1 failed: no such object, nothing to roll back")
+	})
+}
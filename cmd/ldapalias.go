@@ -0,0 +1,254 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/tommi2day/gomodules/dblib"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+const (
+	classNetServiceAlias = "orclNetServiceAlias"
+	attrAliasedObject    = "aliasedObjectName"
+)
+
+// ldapAlias is an orclNetServiceAlias object pointing to another entry
+type ldapAlias struct {
+	Name   string
+	DN     string
+	Target string
+}
+
+var ldapAliasFile = ""
+
+// readLdapAliases returns all orclNetServiceAlias objects below the context
+func readLdapAliases(lc *ldaplib.LdapConfigType, contextDN string) (aliases []ldapAlias, err error) {
+	filter := "(objectClass=" + classNetServiceAlias + ")"
+	// aliases must not be dereferenced to see the alias objects themselves
+	entries, err := lc.Search(contextDN, filter, []string{"cn", attrAliasedObject}, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases)
+	if err != nil {
+		err = fmt.Errorf("search aliases failed: %v", err)
+		return
+	}
+	for _, e := range entries {
+		aliases = append(aliases, ldapAlias{Name: e.GetAttributeValue("cn"), DN: e.DN, Target: e.GetAttributeValue(attrAliasedObject)})
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	log.Debugf("%d alias objects found in %s", len(aliases), contextDN)
+	return
+}
+
+// mergeLdapAliases adds the resolved aliases to the net services of a context
+func mergeLdapAliases(tnsEntries dblib.TNSEntries, aliases []ldapAlias) dblib.TNSEntries {
+	merged := make(dblib.TNSEntries, len(tnsEntries)+len(aliases))
+	for k, e := range tnsEntries {
+		merged[k] = e
+	}
+	for k, e := range resolveLdapAliases(tnsEntries, aliases) {
+		if _, exists := merged[k]; exists {
+			log.Warnf("alias %s hides net service with the same name, ignored", k)
+			continue
+		}
+		merged[k] = e
+	}
+	return merged
+}
+
+// resolveLdapAliases returns TNS entries for alias objects pointing to a net service,
+// directly or through other aliases. Dangling aliases and loops are logged and skipped
+func resolveLdapAliases(tnsEntries dblib.TNSEntries, aliases []ldapAlias) (resolved dblib.TNSEntries) {
+	services := map[string]dblib.TNSEntry{}
+	for _, e := range tnsEntries {
+		services[dnKey(e.Location)] = e
+	}
+	aliasByDN := map[string]ldapAlias{}
+	for _, a := range aliases {
+		aliasByDN[dnKey(a.DN)] = a
+	}
+	resolved = dblib.TNSEntries{}
+	for _, a := range aliases {
+		target := a.Target
+		seen := map[string]bool{dnKey(a.DN): true}
+		for {
+			k := dnKey(target)
+			if e, ok := services[k]; ok {
+				resolved[a.Name] = dblib.TNSEntry{Name: a.Name, Desc: e.Desc, Location: a.DN}
+				log.Debugf("alias %s resolved to %s", a.Name, e.Location)
+				break
+			}
+			next, ok := aliasByDN[k]
+			if !ok {
+				log.Warnf("alias %s points to missing entry %s", a.Name, target)
+				break
+			}
+			if seen[k] {
+				log.Warnf("alias %s is part of an alias loop at %s", a.Name, target)
+				break
+			}
+			seen[k] = true
+			target = next.Target
+		}
+	}
+	return
+}
+
+// dnName returns the value of the first RDN of a DN, the cn of an entry
+func dnName(dn string) string {
+	if d, err := ldap.ParseDN(dn); err == nil && len(d.RDNs) > 0 && len(d.RDNs[0].Attributes) > 0 {
+		return d.RDNs[0].Attributes[0].Value
+	}
+	rdn, _, _ := strings.Cut(dn, ",")
+	_, name, _ := strings.Cut(rdn, "=")
+	return strings.TrimSpace(name)
+}
+
+// serviceDN returns the DN of name below contextDN, alias templates may produce
+// characters which must be escaped in a RDN value
+func serviceDN(name string, contextDN string) string {
+	return "cn=" + ldap.EscapeDN(name) + "," + contextDN
+}
+
+// dnKey normalizes a DN for comparison
+func dnKey(dn string) string {
+	return strings.ToLower(strings.ReplaceAll(dn, " ", ""))
+}
+
+// readAliasMapping reads "alias[,alias] = target" lines. Names are mapped to LDAP aliases with key
+func readAliasMapping(file string, key func(string) string) (mapping map[string]string, err error) {
+	//nolint gosec
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	mapping = map[string]string{}
+	for i, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names, target, found := strings.Cut(line, "=")
+		target = strings.TrimSpace(target)
+		if !found || target == "" || strings.TrimSpace(names) == "" {
+			err = fmt.Errorf("%s line %d: expected 'alias = target'", file, i+1)
+			return
+		}
+		for _, n := range entryAliases(names) {
+			mapping[key(n)] = key(target)
+		}
+	}
+	return
+}
+
+// planAliasItems plans the alias objects of the mapping. services are the names of
+// all net services after the write, existing are the alias objects found in LDAP
+func planAliasItems(contextDN string, mapping map[string]string, existing []ldapAlias, services map[string]bool, keep ldapKeepOptions) (plan []ldapPlanItem) {
+	current := map[string]ldapAlias{}
+	for _, a := range existing {
+		current[a.Name] = a
+	}
+	for _, name := range getSortedAliases(mapping) {
+		item := ldapPlanItem{Alias: name, Action: sNew, DN: serviceDN(name, contextDN), AliasOf: serviceDN(mapping[name], contextDN)}
+		item.Changes = []descChange{{Path: attrAliasedObject, New: item.AliasOf}}
+		if a, ok := current[name]; ok {
+			item.DN = a.DN
+			item.Action = sMod
+			if dnKey(a.Target) == dnKey(item.AliasOf) {
+				item.Action = sOK
+				item.Changes = nil
+			} else {
+				item.Changes = []descChange{{Path: attrAliasedObject, Old: a.Target, New: item.AliasOf}}
+				item.prev = a.Target
+			}
+		}
+		switch {
+		case services[name]:
+			log.Warnf("Skip alias %s, a net service with this name exists", name)
+			item.Action = sSkip
+		case !aliasResolves(name, mapping, services):
+			log.Warnf("Skip alias %s, target %s is no net service or alias loop", name, mapping[name])
+			item.Action = sSkip
+		}
+		plan = append(plan, keepAlias(item, keep))
+	}
+	for _, name := range getSortedAliases(current) {
+		if _, ok := mapping[name]; ok {
+			continue
+		}
+		a := current[name]
+		plan = append(plan, keepAlias(ldapPlanItem{Alias: name, Action: sDel, DN: a.DN, AliasOf: a.Target}, keep))
+	}
+	return
+}
+
+// aliasResolves follows the mapping from name until a net service is reached
+func aliasResolves(name string, mapping map[string]string, services map[string]bool) bool {
+	seen := map[string]bool{}
+	for !seen[name] {
+		seen[name] = true
+		target, ok := mapping[name]
+		if !ok {
+			return false
+		}
+		if services[target] {
+			return true
+		}
+		name = target
+	}
+	return false
+}
+
+// planLdapAliases plans the alias objects of a mapping file against the current context.
+// Names are mapped like the net services with the default domain
+func planLdapAliases(lc *ldaplib.LdapConfigType, contextDN string, file string, domain string, tnsPlan []ldapPlanItem, keep ldapKeepOptions) (plan []ldapPlanItem, err error) {
+	key, err := aliasKey(domain)
+	if err != nil {
+		return
+	}
+	mapping, err := readAliasMapping(file, key)
+	if err != nil {
+		err = fmt.Errorf("cannot read alias mapping: %v", err)
+		return
+	}
+	existing, err := readLdapAliases(lc, contextDN)
+	if err != nil {
+		return
+	}
+	plan = planAliasItems(contextDN, mapping, existing, planServices(tnsPlan), keep)
+	return
+}
+
+// planServices returns the names of the net services which exist after the plan
+func planServices(tnsPlan []ldapPlanItem) map[string]bool {
+	services := map[string]bool{}
+	for _, item := range tnsPlan {
+		if item.Action != sDel {
+			services[item.Alias] = true
+		}
+	}
+	return services
+}
+
+// handleAliasObject adds, modifies or deletes an orclNetServiceAlias object
+func handleAliasObject(lc *ldaplib.LdapConfigType, item ldapPlanItem) (err error) {
+	switch item.Action {
+	case sNew:
+		req := ldap.NewAddRequest(item.DN, nil)
+		req.Attribute("objectClass", []string{"top", "alias", classNetServiceAlias})
+		req.Attribute("cn", []string{item.Alias})
+		req.Attribute(attrAliasedObject, []string{item.AliasOf})
+		err = lc.Conn.Add(req)
+	case sMod:
+		req := ldap.NewModifyRequest(item.DN, nil)
+		req.Replace(attrAliasedObject, []string{item.AliasOf})
+		err = lc.Conn.Modify(req)
+	case sDel:
+		err = lc.Conn.Del(ldap.NewDelRequest(item.DN, nil))
+	}
+	return
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestLdapAlias(t *testing.T) {
+	ctx := "cn=OracleContext," + LdapBaseDn
+	dn := func(name string) string { return "cn=" + name + "," + ctx }
+	services := dblib.TNSEntries{
+		"xe":  {Name: "xe", Location: dn("xe"), Desc: "(DESCRIPTION=(CONNECT_DATA=(SID=XE)))"},
+		"dwh": {Name: "dwh", Location: dn("dwh"), Desc: "(DESCRIPTION=(CONNECT_DATA=(SID=DWH)))"},
+	}
+	aliases := []ldapAlias{
+		{Name: "xe_ro", DN: dn("xe_ro"), Target: "cn=XE, " + ctx},
+		{Name: "xe_ro2", DN: dn("xe_ro2"), Target: dn("xe_ro")},
+		{Name: "loop1", DN: dn("loop1"), Target: dn("loop2")},
+		{Name: "loop2", DN: dn("loop2"), Target: dn("loop1")},
+		{Name: "dangling", DN: dn("dangling"), Target: dn("missing")},
+		{Name: "dwh", DN: "cn=dwh,cn=other," + ctx, Target: dn("xe")},
+	}
+
+	t.Run("resolve", func(t *testing.T) {
+		resolved := resolveLdapAliases(services, aliases)
+		assert.Equal(t, services["xe"].Desc, resolved["xe_ro"].Desc, "direct alias not resolved")
+		assert.Equal(t, dn("xe_ro"), resolved["xe_ro"].Location, "alias location should be its DN")
+		assert.Equal(t, services["xe"].Desc, resolved["xe_ro2"].Desc, "alias of alias not resolved")
+		assert.NotContains(t, resolved, "loop1", "loop should not be resolved")
+		assert.NotContains(t, resolved, "dangling", "dangling alias should not be resolved")
+	})
+	t.Run("merge", func(t *testing.T) {
+		merged := mergeLdapAliases(services, aliases)
+		assert.Equal(t, 4, len(merged), "services and 2 aliases expected")
+		assert.Equal(t, services["dwh"], merged["dwh"], "alias must not hide net service")
+	})
+	t.Run("dn name", func(t *testing.T) {
+		assert.Equal(t, "XE", dnName("cn=XE, "+ctx))
+		assert.Equal(t, "xe_ro", dnName(dn("xe_ro")))
+		assert.Empty(t, dnName(""))
+	})
+	t.Run("mapping file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "aliases.txt")
+		err := common.WriteStringToFile(file, "# alias = target\nXE_RO.local, xe_report = XE.local\n\ndwh_ro = dwh\n")
+		require.NoErrorf(t, err, "create mapping failed: %s", err)
+		mapping, err := readAliasMapping(file, shortAlias)
+		require.NoErrorf(t, err, "read mapping failed: %s", err)
+		assert.Equal(t, map[string]string{"xe_ro": "xe", "xe_report": "xe", "dwh_ro": "dwh"}, mapping)
+		err = common.WriteStringToFile(file, "xe_ro\n")
+		require.NoErrorf(t, err, "create mapping failed: %s", err)
+		_, err = readAliasMapping(file, shortAlias)
+		assert.ErrorContains(t, err, "line 1")
+	})
+	t.Run("plan", func(t *testing.T) {
+		mapping := map[string]string{"xe_ro": "xe", "xe_ro2": "dwh", "new_ro": "xe_ro", "xe": "dwh", "bad": "nothing", "l1": "l2", "l2": "l1"}
+		existing := []ldapAlias{aliases[0], aliases[1], aliases[4]}
+		plan := planAliasItems(ctx, mapping, existing, map[string]bool{"xe": true, "dwh": true}, ldapKeepOptions{})
+		actions := map[string]string{}
+		for _, item := range plan {
+			actions[item.Alias] = item.Action
+		}
+		assert.Equal(t, map[string]string{
+			"xe_ro": sOK, "xe_ro2": sMod, "new_ro": sNew, "xe": sSkip, "bad": sSkip, "l1": sSkip, "l2": sSkip, "dangling": sDel,
+		}, actions, "alias actions not expected")
+		var sb strings.Builder
+		err := writeLdifChanges(&sb, plan)
+		require.NoErrorf(t, err, "write ldif failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "dn: "+dn("new_ro")+"\nchangetype: add\nobjectClass: top\nobjectClass: alias\nobjectClass: orclNetServiceAlias\ncn: new_ro\naliasedObjectName: "+dn("xe_ro")+"\n")
+		assert.Contains(t, out, "dn: "+dn("xe_ro2")+"\nchangetype: modify\nreplace: aliasedObjectName\naliasedObjectName: "+dn("dwh")+"\n-\n")
+		assert.Contains(t, out, "dn: "+dn("dangling")+"\nchangetype: delete\n")
+	})
+}
@@ -0,0 +1,224 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+var ldapRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "restore ldap tns entries from a snapshot",
+	Long: `rebuild the Oracle Context from a LDIF snapshot. Aliases and alias objects missing in the
+snapshot are deleted, all others are added or modified to match the snapshot exactly`,
+	SilenceUsage: true,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		log.Debug("ldapRestore called")
+		return ldapRestore()
+	},
+}
+
+const defaultBackupKeep = 10
+const backupTimeFormat = "20060102T150405.000"
+
+var ldapBackupDir = ""
+var ldapBackupKeep = 0
+var ldapNoBackup = false
+var ldapRestoreFrom = ""
+var backupNameRe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func init() {
+	ldapRestoreCmd.Flags().BoolVar(&ldapAtomic, "atomic", false, "roll back all changes if one operation fails")
+	for _, c := range []*cobra.Command{ldapWriteCmd, ldapClearCmd, ldapRestoreCmd} {
+		c.Flags().StringVar(&ldapBackupDir, "backup-dir", "", "directory for LDIF snapshots taken before changing LDAP, default tnscli/ldap_backup in the user cache dir")
+		c.Flags().BoolVar(&ldapNoBackup, "no-backup", false, "do not take a LDIF snapshot before changing LDAP")
+		c.Flags().IntVar(&ldapBackupKeep, "backup-keep", 0, "number of snapshots to keep per context, 0 means 10, -1 keeps all")
+	}
+	ldapRestoreCmd.Flags().StringVar(&ldapRestoreFrom, "from", "", "LDIF snapshot to restore")
+	ldapRestoreCmd.Flags().BoolVar(&ldapDryRun, "dry-run", false, "print planned changes only, do not modify LDAP")
+	_ = ldapRestoreCmd.MarkFlagRequired("from")
+	ldapCmd.AddCommand(ldapRestoreCmd)
+}
+
+func ldapRestore() (err error) {
+	// print version
+	version := GetVersion(false)
+	log.Info(version)
+
+	content, err := os.ReadFile(ldapRestoreFrom)
+	if err != nil {
+		err = fmt.Errorf("cannot read snapshot: %v", err)
+		return
+	}
+	tnsEntries, aliases, err := readLdifRecords(string(content))
+	if err != nil {
+		err = fmt.Errorf("cannot parse snapshot %s: %v", ldapRestoreFrom, err)
+		return
+	}
+	if len(tnsEntries)+len(aliases) == 0 {
+		// a snapshot of an empty context restores to an empty context
+		log.Warnf("no entries found in %s, all entries of the context will be deleted", ldapRestoreFrom)
+	}
+	lc, err := ldapConnect()
+	if err != nil {
+		return
+	}
+	if ldapDryRun {
+		plan, _, e := planRestoreLdapTns(lc, tnsEntries, aliases, contextDN)
+		if e != nil {
+			err = fmt.Errorf("restore plan failed: %v", e)
+			return
+		}
+		err = writeLdapPlan(os.Stdout, plan)
+		return
+	}
+	if _, err = backupLdapTns(lc, contextDN); err != nil {
+		return
+	}
+	workStatus, err := RestoreLdapTns(lc, tnsEntries, aliases, contextDN)
+	if err != nil {
+		err = fmt.Errorf("restore failed: %v", err)
+		return
+	}
+	if workStatus[sSkip] > 0 {
+		err = fmt.Errorf("restore finished with %d errors", workStatus[sSkip])
+		return
+	}
+	log.Infof("SUCCESS: '%s' restored to LDAP\n", ldapRestoreFrom)
+	fmt.Println("Restore finished successfully. For details run with --info or --debug")
+	return
+}
+
+// RestoreLdapTns makes the context an exact copy of the given entries and alias objects.
+// Aliases are used as stored and --no-delete and --protect are ignored
+func RestoreLdapTns(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, aliases []ldapAlias, contextDN string) (TWorkStatus, error) {
+	log.Infof("Restore LDAP Context %s with %d entries and %d alias objects", contextDN, len(tnsEntries), len(aliases))
+	plan, workStatus, err := planRestoreLdapTns(lc, tnsEntries, aliases, contextDN)
+	if err != nil || ldapDryRun {
+		return workStatus, err
+	}
+	return applyLdapPlan(lc, contextDN, plan)
+}
+
+// planRestoreLdapTns plans the restore without keep options, the snapshot wins.
+// The alias objects are planned after the net services they point to
+func planRestoreLdapTns(lc *ldaplib.LdapConfigType, tnsEntries dblib.TNSEntries, aliases []ldapAlias, contextDN string) (plan []ldapPlanItem, workStatus TWorkStatus, err error) {
+	plan, workStatus, err = planLdapSync(lc, tnsEntries, contextDN, ldapKey, ldapKeepOptions{})
+	if err != nil {
+		return
+	}
+	existing, err := readLdapAliases(lc, contextDN)
+	if err != nil {
+		return
+	}
+	// targets are found by DN, the cn of the target DN may differ in case
+	names := map[string]string{}
+	for _, e := range tnsEntries {
+		names[dnKey(e.Location)] = e.Name
+	}
+	for _, a := range aliases {
+		names[dnKey(a.DN)] = a.Name
+	}
+	mapping := map[string]string{}
+	for _, a := range aliases {
+		target, ok := names[dnKey(a.Target)]
+		if !ok {
+			target = dnName(a.Target)
+		}
+		mapping[ldapKey(a.Name)] = ldapKey(target)
+	}
+	aliasPlan := planAliasItems(contextDN, mapping, existing, planServices(plan), ldapKeepOptions{})
+	for _, item := range aliasPlan {
+		workStatus[item.Action]++
+	}
+	plan = append(plan, aliasPlan...)
+	return
+}
+
+// backupDir returns the configured backup directory or the default in the user cache dir
+func backupDir() string {
+	if ldapBackupDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		ldapBackupDir = filepath.Join(dir, "tnscli", "ldap_backup")
+	}
+	return ldapBackupDir
+}
+
+// backupLdapTns writes a LDIF snapshot of the context to the backup directory
+// and removes old snapshots. Nothing is done with --no-backup
+func backupLdapTns(lc *ldaplib.LdapConfigType, contextDN string) (file string, err error) {
+	if ldapNoBackup {
+		log.Debug("snapshots disabled, skip snapshot")
+		return
+	}
+	dir := backupDir()
+	tnsEntries, err := dblib.ReadLdapTns(lc, contextDN)
+	if err != nil {
+		err = fmt.Errorf("snapshot read failed: %v", err)
+		return
+	}
+	aliases, err := readLdapAliases(lc, contextDN)
+	if err != nil {
+		err = fmt.Errorf("snapshot read failed: %v", err)
+		return
+	}
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		err = fmt.Errorf("cannot create backup directory: %v", err)
+		return
+	}
+	var sb strings.Builder
+	_ = writeLdifEntries(&sb, tnsEntries, contextDN)
+	_ = writeLdifAliases(&sb, aliases)
+	prefix := backupPrefix(contextDN)
+	file = filepath.Join(dir, prefix+time.Now().Format(backupTimeFormat)+".ldif")
+	err = common.WriteStringToFile(file, sb.String())
+	if err != nil {
+		err = fmt.Errorf("cannot write snapshot %s: %v", file, err)
+		return
+	}
+	log.Infof("Snapshot of %d entries and %d alias objects written to %s", len(tnsEntries), len(aliases), file)
+	pruneBackups(dir, prefix, ldapBackupKeep)
+	return
+}
+
+// backupPrefix returns the snapshot file prefix of a context
+func backupPrefix(contextDN string) string {
+	return "tnscli_" + strings.Trim(backupNameRe.ReplaceAllString(contextDN, "_"), "_") + "_"
+}
+
+// pruneBackups removes the oldest snapshots with the given prefix beyond keep
+func pruneBackups(dir string, prefix string, keep int) (removed []string) {
+	if keep < 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"*.ldif"))
+	if err != nil || len(files) <= keep {
+		return
+	}
+	// timestamps sort in name order
+	sort.Strings(files)
+	for _, f := range files[:len(files)-keep] {
+		if err = os.Remove(f); err != nil {
+			log.Warnf("cannot remove old snapshot %s: %v", f, err)
+			continue
+		}
+		log.Debugf("old snapshot %s removed", f)
+		removed = append(removed, f)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLdapBackup(t *testing.T) {
+	ctx := "cn=OracleContext," + LdapBaseDn
+	prefix := backupPrefix(ctx)
+
+	t.Run("prefix", func(t *testing.T) {
+		assert.Equal(t, "tnscli_cn_OracleContext_dc_oracle_dc_local_", prefix)
+	})
+	t.Run("prune", func(t *testing.T) {
+		dir := t.TempDir()
+		names := []string{
+			prefix + "20261001T100000.000.ldif",
+			prefix + "20261002T100000.000.ldif",
+			prefix + "20261003T100000.000.ldif",
+			"tnscli_cn_OracleContext_dc_other_20261001T100000.000.ldif",
+		}
+		for _, n := range names {
+			err := os.WriteFile(filepath.Join(dir, n), []byte("version: 1\n"), 0600)
+			require.NoErrorf(t, err, "create %s failed: %s", n, err)
+		}
+		assert.Empty(t, pruneBackups(dir, prefix, -1), "-1 should keep all")
+		assert.Empty(t, pruneBackups(dir, prefix, 3), "nothing to remove expected")
+		removed := pruneBackups(dir, prefix, 1)
+		assert.Equal(t, []string{filepath.Join(dir, names[0]), filepath.Join(dir, names[1])}, removed, "oldest snapshots should be removed")
+		assert.FileExists(t, filepath.Join(dir, names[2]), "newest snapshot should be kept")
+		assert.FileExists(t, filepath.Join(dir, names[3]), "other context should not be touched")
+	})
+	t.Run("default directory", func(t *testing.T) {
+		dir := ldapBackupDir
+		defer func() { ldapBackupDir = dir }()
+		ldapBackupDir = ""
+		cache, err := os.UserCacheDir()
+		require.NoErrorf(t, err, "no user cache dir: %s", err)
+		assert.Equal(t, filepath.Join(cache, "tnscli", "ldap_backup"), backupDir(), "default below the user cache dir expected")
+		ldapBackupDir = "/var/backup/tnscli"
+		assert.Equal(t, "/var/backup/tnscli", backupDir(), "configured directory expected")
+	})
+	t.Run("no backup", func(t *testing.T) {
+		ldapNoBackup = true
+		defer func() { ldapNoBackup = false }()
+		file, err := backupLdapTns(nil, ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, file, "no snapshot expected with --no-backup")
+	})
+}
@@ -0,0 +1,178 @@
+// Package cmd commands
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+const (
+	bindSimple    = "simple"
+	bindExternal  = "external"
+	bindAnonymous = "anonymous"
+)
+
+var ldapCert = ""
+var ldapCertKey = ""
+var ldapCACert = ""
+var ldapBindMech = ""
+var ldapStartTLS = false
+
+func init() {
+	ldapCmd.PersistentFlags().StringVar(&ldapCert, "ldap.cert", "", "PEM client certificate for mutual TLS")
+	ldapCmd.PersistentFlags().StringVar(&ldapCertKey, "ldap.key", "", "PEM private key of the client certificate")
+	ldapCmd.PersistentFlags().StringVar(&ldapCACert, "ldap.cacert", "", "PEM CA bundle to verify the LDAP server")
+	ldapCmd.PersistentFlags().BoolVar(&ldapStartTLS, "ldap.starttls", false, "upgrade plain ldap connections with StartTLS")
+	ldapCmd.PersistentFlags().StringVar(&ldapBindMech, "ldap.bindmech", "", "bind mechanism: simple, external (SASL EXTERNAL) or anonymous")
+}
+
+// initLdapBindConfig reads the bind settings from config if not set on commandline
+func initLdapBindConfig() {
+	if ldapCert == "" {
+		ldapCert = viper.GetString("ldap.cert")
+	}
+	if ldapCertKey == "" {
+		ldapCertKey = viper.GetString("ldap.key")
+	}
+	if ldapCACert == "" {
+		ldapCACert = viper.GetString("ldap.cacert")
+	}
+	if ldapBindMech == "" {
+		ldapBindMech = viper.GetString("ldap.bindmech")
+	}
+	if !ldapStartTLS {
+		ldapStartTLS = viper.GetBool("ldap.starttls")
+	}
+}
+
+// checkBindConfig validates the bind mechanism and the certificate settings
+func checkBindConfig() (err error) {
+	ldapBindMech = strings.ToLower(strings.TrimSpace(ldapBindMech))
+	if ldapBindMech == "" {
+		ldapBindMech = bindSimple
+	}
+	switch ldapBindMech {
+	case bindSimple, bindAnonymous:
+	case bindExternal:
+		if ldapCert == "" {
+			err = fmt.Errorf("bind mechanism %s needs a client certificate (ldap.cert)", bindExternal)
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown bind mechanism '%s', use %s, %s or %s", ldapBindMech, bindSimple, bindExternal, bindAnonymous)
+		return
+	}
+	if (ldapCert == "") != (ldapCertKey == "") {
+		err = fmt.Errorf("client certificate needs both ldap.cert and ldap.key")
+		return
+	}
+	if ldapTLS && ldapStartTLS {
+		err = fmt.Errorf("ldap.tls and ldap.starttls cannot be used together")
+	}
+	return
+}
+
+// ldapTLSConfig builds the TLS settings with the CA bundle and client certificate
+func ldapTLSConfig(host string) (tc *tls.Config, err error) {
+	//nolint gosec
+	tc = &tls.Config{ServerName: host, InsecureSkipVerify: ldapInsecure, MinVersion: tls.VersionTLS12}
+	if ldapCACert != "" {
+		var pem []byte
+		//nolint gosec
+		pem, err = os.ReadFile(ldapCACert)
+		if err != nil {
+			err = fmt.Errorf("cannot read CA bundle: %v", err)
+			return
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("no certificates found in CA bundle %s", ldapCACert)
+			return
+		}
+	}
+	if ldapCert != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(ldapCert, ldapCertKey)
+		if err != nil {
+			err = fmt.Errorf("cannot load client certificate: %v", err)
+			return
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
+
+// ldapBind connects to a server and binds with the configured mechanism. Simple and
+// anonymous binds without StartTLS and certificate settings use the ldaplib defaults
+func ldapBind(c ldapCandidate) (lc *ldaplib.LdapConfigType, err error) {
+	lc = ldaplib.NewConfig(c.Host, c.Port, c.TLS, ldapInsecure, ldapBaseDN, ldapTimeout)
+	if !c.StartTLS && ldapBindMech != bindExternal && ldapCert == "" && ldapCACert == "" {
+		bindDN, pw := ldapBindDN, ldapBindPassword
+		if ldapBindMech == bindAnonymous {
+			bindDN, pw = "", ""
+		}
+		err = lc.Connect(bindDN, pw)
+		return
+	}
+	if !c.TLS && !c.StartTLS {
+		err = fmt.Errorf("client certificates and SASL EXTERNAL need a TLS connection (ldap.tls or ldap.starttls)")
+		return
+	}
+	tc, err := ldapTLSConfig(c.Host)
+	if err != nil {
+		return
+	}
+	conn, err := dialLdap(c, tc)
+	if err != nil {
+		return
+	}
+	switch {
+	case ldapBindMech == bindExternal:
+		err = conn.ExternalBind()
+	case ldapBindMech == bindSimple && ldapBindDN != "":
+		err = conn.Bind(ldapBindDN, ldapBindPassword)
+	}
+	if err != nil {
+		_ = conn.Close()
+		err = fmt.Errorf("%s bind failed: %v", ldapBindMech, err)
+		return
+	}
+	log.Debugf("Ldap %s bind to %s with client certificate %s", ldapBindMech, c.address(), ldapCert)
+	lc.Conn = conn
+	return
+}
+
+// dialLdap opens a ldaps connection or upgrades a plain connection with StartTLS
+func dialLdap(c ldapCandidate, tc *tls.Config) (conn *ldap.Conn, err error) {
+	timeout := time.Duration(ldapTimeout) * time.Second
+	dialer := ldap.DialWithDialer(&net.Dialer{Timeout: timeout})
+	if c.TLS {
+		conn, err = ldap.DialURL("ldaps://"+c.address(), dialer, ldap.DialWithTLSConfig(tc))
+		if err != nil {
+			return
+		}
+		conn.SetTimeout(timeout)
+		return
+	}
+	conn, err = ldap.DialURL("ldap://"+c.address(), dialer)
+	if err != nil {
+		return
+	}
+	conn.SetTimeout(timeout)
+	if err = conn.StartTLS(tc); err != nil {
+		_ = conn.Close()
+		conn = nil
+		err = fmt.Errorf("StartTLS refused by %s: %v", c.address(), err)
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert creates a self-signed certificate and key as PEM files
+func writeTestCert(t *testing.T, dir string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoErrorf(t, err, "generate key failed: %s", err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tnscli"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoErrorf(t, err, "create certificate failed: %s", err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoErrorf(t, err, "marshal key failed: %s", err)
+	certFile = path.Join(dir, "client.crt")
+	keyFile = path.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return
+}
+
+func TestLdapBind(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+	defer func() {
+		ldapCert, ldapCertKey, ldapCACert, ldapBindMech = "", "", "", ""
+	}()
+
+	t.Run("check bind config", func(t *testing.T) {
+		ldapCert, ldapCertKey, ldapCACert = "", "", ""
+		ldapBindMech = ""
+		require.NoError(t, checkBindConfig())
+		assert.Equal(t, bindSimple, ldapBindMech, "simple should be default")
+		ldapBindMech = "Anonymous"
+		require.NoError(t, checkBindConfig())
+		assert.Equal(t, bindAnonymous, ldapBindMech)
+		ldapBindMech = "gssapi"
+		assert.ErrorContains(t, checkBindConfig(), "unknown bind mechanism")
+		ldapBindMech = bindExternal
+		assert.ErrorContains(t, checkBindConfig(), "needs a client certificate")
+		ldapCert = certFile
+		assert.ErrorContains(t, checkBindConfig(), "both ldap.cert and ldap.key")
+		ldapCertKey = keyFile
+		assert.NoError(t, checkBindConfig())
+		ldapTLS, ldapStartTLS = true, true
+		assert.ErrorContains(t, checkBindConfig(), "cannot be used together")
+		ldapTLS, ldapStartTLS = false, false
+	})
+	t.Run("tls config", func(t *testing.T) {
+		ldapCert, ldapCertKey, ldapCACert = certFile, keyFile, certFile
+		tc, err := ldapTLSConfig("ldap.example.com")
+		require.NoErrorf(t, err, "tls config failed: %s", err)
+		assert.Equal(t, "ldap.example.com", tc.ServerName)
+		assert.Len(t, tc.Certificates, 1, "client certificate expected")
+		assert.NotNil(t, tc.RootCAs, "CA pool expected")
+		ldapCACert = keyFile
+		_, err = ldapTLSConfig("ldap.example.com")
+		assert.ErrorContains(t, err, "no certificates found")
+		ldapCACert = ""
+		ldapCertKey = path.Join(dir, "missing.key")
+		_, err = ldapTLSConfig("ldap.example.com")
+		assert.ErrorContains(t, err, "cannot load client certificate")
+	})
+	t.Run("external needs tls", func(t *testing.T) {
+		ldapCert, ldapCertKey, ldapBindMech = certFile, keyFile, bindExternal
+		_, err := ldapBind(ldapCandidate{Host: "localhost", Port: 1, TLS: false})
+		assert.ErrorContains(t, err, "need a TLS connection")
+	})
+}
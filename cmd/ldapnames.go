@@ -0,0 +1,154 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+const (
+	aliasModeShort    = "short"
+	aliasModeFull     = "full"
+	aliasModeDomain   = "domain"
+	aliasModeTemplate = "template"
+)
+
+var ldapAliasMode = ""
+var ldapAliasDomain = ""
+var ldapAliasTemplate = ""
+
+// aliasNameParts are the fields usable in an alias template
+type aliasNameParts struct {
+	// Alias is the alias as written in tnsnames.ora
+	Alias string
+	// Name is the lowercase alias
+	Name string
+	// Short is the lowercase alias up to the first dot
+	Short string
+	// Domain is the lowercase part after the first dot
+	Domain string
+}
+
+func init() {
+	ldapCmd.PersistentFlags().StringVar(&ldapAliasMode, "ldap.aliasmode", "", "LDAP alias of tnsnames.ora aliases: short (default), full, domain or template")
+	ldapCmd.PersistentFlags().StringVar(&ldapAliasDomain, "ldap.aliasdomain", "", "domain to strip with alias mode domain, default NAMES.DEFAULT_DOMAIN")
+	ldapCmd.PersistentFlags().StringVar(&ldapAliasTemplate, "ldap.aliastemplate", "", "go template for alias mode template, e.g. '{{.Short}}_{{.Domain}}'")
+}
+
+// initAliasConfig reads the alias normalization from config if not set on commandline
+func initAliasConfig() {
+	if ldapAliasMode == "" {
+		ldapAliasMode = viper.GetString("ldap.aliasmode")
+	}
+	if ldapAliasDomain == "" {
+		ldapAliasDomain = viper.GetString("ldap.aliasdomain")
+	}
+	if ldapAliasTemplate == "" {
+		ldapAliasTemplate = viper.GetString("ldap.aliastemplate")
+	}
+}
+
+// aliasKey returns the function mapping a tnsnames.ora alias to its LDAP alias
+// for the configured alias mode. domain is the default domain of the entries
+func aliasKey(domain string) (key func(string) string, err error) {
+	switch strings.ToLower(ldapAliasMode) {
+	case "", aliasModeShort:
+		key = shortAlias
+	case aliasModeFull:
+		key = strings.ToLower
+	case aliasModeDomain:
+		if ldapAliasDomain != "" {
+			domain = ldapAliasDomain
+		}
+		suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+		if suffix == "." {
+			err = fmt.Errorf("alias mode %s needs ldap.aliasdomain or NAMES.DEFAULT_DOMAIN", aliasModeDomain)
+			return
+		}
+		key = func(alias string) string {
+			return strings.TrimSuffix(strings.ToLower(alias), suffix)
+		}
+	case aliasModeTemplate:
+		key, err = templateAliasKey(ldapAliasTemplate)
+	default:
+		err = fmt.Errorf("unknown alias mode '%s', use %s, %s, %s or %s", ldapAliasMode, aliasModeShort, aliasModeFull, aliasModeDomain, aliasModeTemplate)
+	}
+	return
+}
+
+// templateAliasKey builds the alias with a template, the result is lowercased
+func templateAliasKey(text string) (key func(string) string, err error) {
+	if text == "" {
+		err = fmt.Errorf("alias mode %s needs ldap.aliastemplate", aliasModeTemplate)
+		return
+	}
+	tmpl, err := template.New("alias").Option("missingkey=error").Parse(text)
+	if err != nil {
+		err = fmt.Errorf("invalid alias template: %v", err)
+		return
+	}
+	execute := func(alias string) (string, error) {
+		var sb strings.Builder
+		e := tmpl.Execute(&sb, newAliasNameParts(alias))
+		return strings.ToLower(strings.TrimSpace(sb.String())), e
+	}
+	// check the template once, it only sees aliasNameParts
+	if _, err = execute("db.example"); err != nil {
+		err = fmt.Errorf("invalid alias template: %v", err)
+		return
+	}
+	key = func(alias string) string {
+		name, e := execute(alias)
+		if e != nil || name == "" {
+			log.Warnf("alias template failed for %s, use %s", alias, strings.ToLower(alias))
+			return strings.ToLower(alias)
+		}
+		return name
+	}
+	return
+}
+
+func newAliasNameParts(alias string) aliasNameParts {
+	name := strings.ToLower(alias)
+	short, domain, _ := strings.Cut(name, ".")
+	return aliasNameParts{Alias: alias, Name: name, Short: short, Domain: domain}
+}
+
+// checkAliasCollisions reports tnsnames.ora aliases with different descriptors
+// which are mapped to the same LDAP alias
+func checkAliasCollisions(tnsEntries dblib.TNSEntries, key func(string) string) error {
+	byKey := map[string][]dblib.TNSEntry{}
+	for _, e := range tnsEntries {
+		k := key(e.Name)
+		byKey[k] = append(byKey[k], e)
+	}
+	var collisions []string
+	for _, k := range getSortedAliases(byKey) {
+		entries := byKey[k]
+		if len(entries) < 2 {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		names := make([]string, 0, len(entries))
+		conflict := false
+		for _, e := range entries {
+			names = append(names, e.Name)
+			conflict = conflict || !descEqual(entries[0].Desc, e.Desc)
+		}
+		if !conflict {
+			log.Debugf("aliases %s share LDAP alias %s with the same descriptor", strings.Join(names, ", "), k)
+			continue
+		}
+		collisions = append(collisions, fmt.Sprintf("%s <- %s", k, strings.Join(names, ", ")))
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("alias collisions, different entries map to the same LDAP alias: %s", strings.Join(collisions, "; "))
+	}
+	return nil
+}
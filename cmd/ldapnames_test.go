@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestLdapNames(t *testing.T) {
+	defer func() {
+		ldapAliasMode, ldapAliasDomain, ldapAliasTemplate = "", "", ""
+	}()
+	descProd := "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=prod)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=DB)))"
+	descTest := "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=test)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=DB)))"
+
+	t.Run("alias modes", func(t *testing.T) {
+		tests := []struct {
+			mode, domain, tmpl, alias, expected string
+		}{
+			{"", "", "", "DB.PROD.example", "db"},
+			{aliasModeShort, "", "", "DB.PROD.example", "db"},
+			{aliasModeFull, "", "", "DB.PROD.example", "db.prod.example"},
+			{aliasModeDomain, "", "", "DB.PROD.example", "db.prod"},
+			{aliasModeDomain, "", "", "DB.other.com", "db.other.com"},
+			{aliasModeDomain, "prod.example", "", "DB.PROD.example", "db"},
+			{aliasModeTemplate, "", "{{.Short}}_{{.Domain}}", "DB.PROD.example", "db_prod.example"},
+			{aliasModeTemplate, "", "{{.Short}}", "XE", "xe"},
+		}
+		for _, tc := range tests {
+			ldapAliasMode, ldapAliasDomain, ldapAliasTemplate = tc.mode, tc.domain, tc.tmpl
+			key, err := aliasKey("example")
+			require.NoErrorf(t, err, "mode %s failed: %s", tc.mode, err)
+			assert.Equalf(t, tc.expected, key(tc.alias), "mode %s alias %s", tc.mode, tc.alias)
+		}
+	})
+	t.Run("alias mode errors", func(t *testing.T) {
+		ldapAliasDomain, ldapAliasTemplate = "", ""
+		ldapAliasMode = "upper"
+		_, err := aliasKey("")
+		assert.ErrorContains(t, err, "unknown alias mode")
+		ldapAliasMode = aliasModeDomain
+		_, err = aliasKey("")
+		assert.ErrorContains(t, err, "needs ldap.aliasdomain")
+		ldapAliasMode = aliasModeTemplate
+		_, err = aliasKey("")
+		assert.ErrorContains(t, err, "needs ldap.aliastemplate")
+		ldapAliasTemplate = "{{.Short"
+		_, err = aliasKey("")
+		assert.ErrorContains(t, err, "invalid alias template")
+		ldapAliasTemplate = "{{.Host}}"
+		_, err = aliasKey("")
+		assert.ErrorContains(t, err, "invalid alias template")
+	})
+	t.Run("collisions", func(t *testing.T) {
+		entries := dblib.TNSEntries{
+			"DB.PROD.example": {Name: "DB.PROD.example", Desc: descProd},
+			"DB.TEST.example": {Name: "DB.TEST.example", Desc: descTest},
+			"XE":              {Name: "XE", Desc: descTest},
+			"XE.example":      {Name: "XE.example", Desc: descTest},
+		}
+		err := checkAliasCollisions(entries, shortAlias)
+		require.Error(t, err, "collision expected")
+		assert.EqualError(t, err, "alias collisions, different entries map to the same LDAP alias: db <- DB.PROD.example, DB.TEST.example")
+		assert.NoError(t, checkAliasCollisions(entries, func(a string) string { return newAliasNameParts(a).Name }), "full names should not collide")
+	})
+	t.Run("template with special characters", func(t *testing.T) {
+		ctx := "cn=OracleContext," + LdapBaseDn
+		ldapAliasMode, ldapAliasTemplate = aliasModeTemplate, "{{.Short}},{{.Domain}}+x"
+		key, err := aliasKey("")
+		ldapAliasMode, ldapAliasTemplate = "", ""
+		require.NoErrorf(t, err, "template alias key failed: %s", err)
+		entries := dblib.TNSEntries{"DB.example": {Name: "DB.example", Desc: descProd}}
+		item := planAlias(ctx, "DB.example", sNew, dblib.TNSEntries{}, getLowercaseTNS(entries, key), key)
+		assert.Equal(t, `cn=db\,example\+x,`+ctx, item.DN, "special characters not escaped")
+		assert.Equal(t, "db,example+x", dnName(item.DN), "escaped name not parsed")
+		plan := planAliasItems(ctx, map[string]string{"ro,db": "db,example+x"}, nil, map[string]bool{"db,example+x": true}, ldapKeepOptions{})
+		require.Len(t, plan, 1, "one alias item expected")
+		assert.Equal(t, `cn=ro\,db,`+ctx, plan[0].DN, "alias dn not escaped")
+		assert.Equal(t, item.DN, plan[0].AliasOf, "alias target not escaped")
+	})
+}
@@ -0,0 +1,182 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+var ldapSearchCmd = &cobra.Command{
+	Use:   "search [alias]",
+	Short: "show ldap attributes of tns entries",
+	Long: `search net services and alias objects in the Oracle Context by alias name or regex
+and print dn, cn, orclNetDescString and the operational attributes who and when an entry was created and changed.
+Without alias all entries are shown`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		log.Debug("ldapSearch called")
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		return ldapSearch(name)
+	},
+}
+
+const ldapTimeFormat = "20060102150405Z0700"
+
+var ldapSearchRegex = false
+var ldapSearchOutput = outputText
+
+// ldapSearchEntry holds the raw attributes of a net service or alias object
+type ldapSearchEntry struct {
+	DN              string `json:"dn" yaml:"dn"`
+	CN              string `json:"cn" yaml:"cn"`
+	Desc            string `json:"orclNetDescString,omitempty" yaml:"orclNetDescString,omitempty"`
+	AliasOf         string `json:"aliasedObjectName,omitempty" yaml:"aliasedObjectName,omitempty"`
+	CreateTimestamp string `json:"createTimestamp,omitempty" yaml:"createTimestamp,omitempty"`
+	CreatorsName    string `json:"creatorsName,omitempty" yaml:"creatorsName,omitempty"`
+	ModifyTimestamp string `json:"modifyTimestamp,omitempty" yaml:"modifyTimestamp,omitempty"`
+	ModifiersName   string `json:"modifiersName,omitempty" yaml:"modifiersName,omitempty"`
+}
+
+var ldapSearchAttributes = []string{
+	"cn", attrDescString, attrAliasedObject,
+	"createTimestamp", "creatorsName", "modifyTimestamp", "modifiersName",
+}
+
+func init() {
+	ldapSearchCmd.Flags().BoolVar(&ldapSearchRegex, "regex", false, "treat alias as case insensitive regular expression")
+	ldapSearchCmd.Flags().StringVar(&ldapSearchOutput, "output", ldapSearchOutput, "output format: text, json or yaml")
+	ldapCmd.AddCommand(ldapSearchCmd)
+}
+
+func ldapSearch(name string) (err error) {
+	format, err := checkOutputFormat(ldapSearchOutput, outputText, outputJSON, outputYAML)
+	if err != nil {
+		return
+	}
+	var re *regexp.Regexp
+	if ldapSearchRegex && name != "" {
+		re, err = regexp.Compile("(?i)" + name)
+		if err != nil {
+			err = fmt.Errorf("invalid regex '%s': %v", name, err)
+			return
+		}
+	}
+	lc, err := ldapConnect()
+	if err != nil {
+		return
+	}
+	entries, err := searchLdapEntries(lc, contextDN, ldapSearchFilter(name, re != nil))
+	if err != nil {
+		return
+	}
+	entries = matchSearchEntries(entries, re)
+	log.Infof("%d entries found in %s", len(entries), contextDN)
+	if format == outputText {
+		err = writeLdapSearch(os.Stdout, entries)
+	} else {
+		err = writeStructured(os.Stdout, format, entries)
+	}
+	if err == nil && len(entries) == 0 && name != "" {
+		err = fmt.Errorf("no entry matching '%s' found", name)
+	}
+	return
+}
+
+// ldapSearchFilter returns the filter for a net service or alias object name.
+// Regex matches are done on the result, so all objects are requested
+func ldapSearchFilter(name string, regex bool) string {
+	filter := "(|(objectClass=orclNetService)(objectClass=" + classNetServiceAlias + "))"
+	if name == "" || regex {
+		return filter
+	}
+	return "(&" + filter + "(cn=" + ldap.EscapeFilter(name) + "))"
+}
+
+// searchLdapEntries returns the requested attributes of all matching entries below the context
+func searchLdapEntries(lc *ldaplib.LdapConfigType, contextDN string, filter string) (entries []ldapSearchEntry, err error) {
+	result, err := lc.Search(contextDN, filter, ldapSearchAttributes, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases)
+	if err != nil {
+		err = fmt.Errorf("ldap search failed: %v", err)
+		return
+	}
+	for _, e := range result {
+		entries = append(entries, newSearchEntry(e))
+	}
+	sort.Slice(entries, func(i, j int) bool { return strings.ToLower(entries[i].CN) < strings.ToLower(entries[j].CN) })
+	return
+}
+
+// newSearchEntry converts a LDAP entry, timestamps are formatted as RFC3339
+func newSearchEntry(e *ldap.Entry) ldapSearchEntry {
+	return ldapSearchEntry{
+		DN:              e.DN,
+		CN:              e.GetAttributeValue("cn"),
+		Desc:            e.GetAttributeValue(attrDescString),
+		AliasOf:         e.GetAttributeValue(attrAliasedObject),
+		CreatorsName:    e.GetAttributeValue("creatorsName"),
+		ModifiersName:   e.GetAttributeValue("modifiersName"),
+		CreateTimestamp: ldapTime(e.GetAttributeValue("createTimestamp")),
+		ModifyTimestamp: ldapTime(e.GetAttributeValue("modifyTimestamp")),
+	}
+}
+
+// ldapTime converts a LDAP generalized time to RFC3339, other values are returned unchanged
+func ldapTime(value string) string {
+	t, err := time.Parse(ldapTimeFormat, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// matchSearchEntries keeps the entries whose cn matches re, all if re is nil
+func matchSearchEntries(entries []ldapSearchEntry, re *regexp.Regexp) []ldapSearchEntry {
+	if re == nil {
+		return entries
+	}
+	matched := make([]ldapSearchEntry, 0, len(entries))
+	for _, e := range entries {
+		if re.MatchString(e.CN) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// writeLdapSearch prints the entries as table, alias objects show their target as description
+func writeLdapSearch(w io.Writer, entries []ldapSearchEntry) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CN\tMODIFIED\tMODIFIED BY\tCREATED BY\tDN\tDESCRIPTION")
+	for _, e := range entries {
+		desc := e.Desc
+		if e.AliasOf != "" {
+			desc = "alias of " + e.AliasOf
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.CN, dashValue(e.ModifyTimestamp), dashValue(e.ModifiersName), dashValue(e.CreatorsName), e.DN, desc)
+	}
+	err = tw.Flush()
+	return
+}
+
+func dashValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
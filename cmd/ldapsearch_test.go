@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLdapSearch(t *testing.T) {
+	ctx := "cn=OracleContext," + LdapBaseDn
+	entries := []ldapSearchEntry{
+		{CN: "xe", DN: "cn=xe," + ctx, Desc: "(DESCRIPTION=(CONNECT_DATA=(SID=XE)))", ModifyTimestamp: "2026-10-01T12:00:00Z", ModifiersName: "cn=admin," + LdapBaseDn},
+		{CN: "xe_ro", DN: "cn=xe_ro," + ctx, AliasOf: "cn=xe," + ctx},
+		{CN: "orcl", DN: "cn=orcl," + ctx, Desc: "(DESCRIPTION=(CONNECT_DATA=(SID=ORCL)))"},
+	}
+
+	t.Run("filter", func(t *testing.T) {
+		all := "(|(objectClass=orclNetService)(objectClass=orclNetServiceAlias))"
+		assert.Equal(t, all, ldapSearchFilter("", false))
+		assert.Equal(t, all, ldapSearchFilter("xe.*", true), "regex should search all entries")
+		assert.Equal(t, "(&"+all+"(cn=a\\2ab))", ldapSearchFilter("a*b", false), "name should be escaped")
+	})
+	t.Run("timestamp", func(t *testing.T) {
+		assert.Equal(t, "2026-10-01T12:00:00Z", ldapTime("20261001120000Z"))
+		assert.Equal(t, "2026-10-01T10:00:00Z", ldapTime("20261001120000+0200"))
+		assert.Equal(t, "", ldapTime(""))
+		assert.Equal(t, "yesterday", ldapTime("yesterday"), "unknown format should be unchanged")
+	})
+	t.Run("entry", func(t *testing.T) {
+		e := ldap.NewEntry("cn=xe,"+ctx, map[string][]string{
+			"cn":              {"xe"},
+			attrDescString:    {"(DESCRIPTION=(CONNECT_DATA=(SID=XE)))"},
+			"modifyTimestamp": {"20261001120000Z"},
+			"creatorsName":    {"cn=admin," + LdapBaseDn},
+		})
+		s := newSearchEntry(e)
+		assert.Equal(t, "xe", s.CN)
+		assert.Equal(t, "2026-10-01T12:00:00Z", s.ModifyTimestamp)
+		assert.Equal(t, "cn=admin,"+LdapBaseDn, s.CreatorsName)
+		assert.Empty(t, s.AliasOf)
+	})
+	t.Run("regex", func(t *testing.T) {
+		assert.Len(t, matchSearchEntries(entries, nil), 3, "all entries expected without regex")
+		m := matchSearchEntries(entries, regexp.MustCompile("(?i)^XE"))
+		require.Len(t, m, 2, "2 matches expected")
+		assert.Equal(t, "xe_ro", m[1].CN)
+	})
+	t.Run("table", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeLdapSearch(&sb, entries)
+		require.NoErrorf(t, err, "write table failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 4, "header and 3 lines expected")
+		assert.True(t, strings.HasPrefix(lines[0], "CN "), "header expected")
+		assert.Contains(t, lines[1], "2026-10-01T12:00:00Z  cn=admin,"+LdapBaseDn)
+		assert.Contains(t, lines[2], "alias of cn=xe,"+ctx)
+		assert.True(t, strings.HasPrefix(lines[3], "orcl "), "orcl expected last")
+		assert.Contains(t, lines[3], "-  ", "missing values should be shown as dash")
+	})
+}
@@ -0,0 +1,279 @@
+// Package cmd commands
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/dblib"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+var ldapStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "check all configured ldap servers",
+	Long: `probe every server of ldap.ora and every --ldap.host concurrently for reachability,
+TLS handshake, bind and Oracle Context and print the result as table`,
+	SilenceUsage: true,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		log.Debug("ldapStatus called")
+		return ldapStatus()
+	},
+}
+
+const (
+	sourceFlag    = "flag"
+	sourceLdapOra = "ldap.ora"
+)
+
+var ldapStatusOutput = outputText
+
+// ldapCandidate is one LDAP server to connect to
+type ldapCandidate struct {
+	Host     string
+	Port     int
+	TLS      bool
+	StartTLS bool
+	Source   string
+}
+
+// ldapProbe is the health of one LDAP server
+type ldapProbe struct {
+	Server    string `json:"server" yaml:"server"`
+	Port      int    `json:"port" yaml:"port"`
+	TLS       bool   `json:"tls" yaml:"tls"`
+	StartTLS  bool   `json:"starttls" yaml:"starttls"`
+	Source    string `json:"source" yaml:"source"`
+	Reachable bool   `json:"reachable" yaml:"reachable"`
+	TLSStatus string `json:"tls_status" yaml:"tls_status"`
+	Bind      bool   `json:"bind" yaml:"bind"`
+	Context   string `json:"context,omitempty" yaml:"context,omitempty"`
+	ConnectMS int64  `json:"connect_ms" yaml:"connect_ms"`
+	Healthy   bool   `json:"healthy" yaml:"healthy"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+	lc        *ldaplib.LdapConfigType
+	connect   time.Duration
+}
+
+func init() {
+	ldapStatusCmd.Flags().StringVar(&ldapStatusOutput, "output", ldapStatusOutput, "output format: text, json or yaml")
+	ldapCmd.AddCommand(ldapStatusCmd)
+}
+
+func ldapStatus() (err error) {
+	format, err := checkOutputFormat(ldapStatusOutput, outputText, outputJSON, outputYAML)
+	if err != nil {
+		return
+	}
+	servers, err := ldapPrepare()
+	if err != nil {
+		return
+	}
+	candidates := ldapCandidates(servers, true)
+	if len(candidates) == 0 {
+		err = fmt.Errorf("no Ldap Servers configured")
+		return
+	}
+	probes := probeLdapServers(candidates)
+	healthy := 0
+	for _, p := range probes {
+		if p.lc != nil && p.lc.Conn != nil {
+			_ = p.lc.Conn.Close()
+		}
+		if p.Healthy {
+			healthy++
+		}
+	}
+	if format == outputText {
+		err = writeLdapStatus(os.Stdout, probes)
+	} else {
+		err = writeStructured(os.Stdout, format, probes)
+	}
+	if err == nil && healthy == 0 {
+		err = fmt.Errorf("no healthy ldap server found")
+	}
+	log.Infof("%d of %d ldap servers healthy", healthy, len(probes))
+	return
+}
+
+// ldapCandidates lists the servers given by --ldap.host and ldap.ora. Without all
+// the servers of ldap.ora are only used if no --ldap.host is given. With StartTLS
+// the plain ldap.ora port is upgraded instead of using the SSL port
+func ldapCandidates(servers []dblib.LdapServer, all bool) (candidates []ldapCandidate) {
+	for _, h := range strings.Split(ldapServer, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			candidates = append(candidates, ldapCandidate{Host: h, Port: ldapPort, TLS: ldapTLS, StartTLS: ldapStartTLS, Source: sourceFlag})
+		}
+	}
+	if len(candidates) > 0 && !all {
+		return
+	}
+	for _, s := range servers {
+		c := ldapCandidate{Host: s.Hostname, Port: s.Port, StartTLS: ldapStartTLS, Source: sourceLdapOra}
+		if s.SSLPort > 0 && (!ldapStartTLS || s.Port == 0) {
+			c.StartTLS = false
+			c.Port = s.SSLPort
+			c.TLS = true
+		}
+		candidates = append(candidates, c)
+	}
+	return
+}
+
+// address returns host:port, port 0 selects the LDAP default port
+func (c ldapCandidate) address() string {
+	port := c.Port
+	if port == 0 {
+		port = 389
+		if c.TLS {
+			port = 636
+		}
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// probeLdapServers checks all candidates concurrently, the result keeps the candidate order
+func probeLdapServers(candidates []ldapCandidate) []ldapProbe {
+	probes := make([]ldapProbe, len(candidates))
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probes[i] = probeLdapServer(c)
+		}()
+	}
+	wg.Wait()
+	return probes
+}
+
+// probeLdapServer checks TCP, TLS, bind and the Oracle Context of one server.
+// The bound connection is kept in the result for reuse
+func probeLdapServer(c ldapCandidate) (p ldapProbe) {
+	p = ldapProbe{Server: c.Host, Port: c.Port, TLS: c.TLS, StartTLS: c.StartTLS, Source: c.Source, TLSStatus: "-"}
+	timeout := time.Duration(ldapTimeout) * time.Second
+	log.Debugf("Probe Ldap Server %s, Port %d, TLS %v, StartTLS %v", c.Host, c.Port, c.TLS, c.StartTLS)
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", c.address(), timeout)
+	if err != nil {
+		p.Error = err.Error()
+		return
+	}
+	_ = conn.Close()
+	p.Reachable = true
+	if c.TLS || c.StartTLS {
+		p.TLSStatus = checkLdapTLS(c, timeout)
+		if p.TLSStatus != "valid" && !ldapInsecure {
+			p.Error = "TLS " + p.TLSStatus
+			return
+		}
+	}
+	lc, err := ldapBind(c)
+	p.connect = time.Since(start)
+	p.ConnectMS = p.connect.Milliseconds()
+	if err != nil || lc.Conn == nil {
+		p.Error = fmt.Sprintf("bind failed: %v", err)
+		return
+	}
+	p.Bind = true
+	p.lc = lc
+	base := ldapBaseDN
+	if contextDN != "" {
+		base = contextDN
+	}
+	if base != "" {
+		p.Context, err = dblib.GetOracleContext(lc, base)
+		if p.Context == "" {
+			p.Error = fmt.Sprintf("no Oracle Context below %s: %v", base, err)
+			return
+		}
+	}
+	p.Healthy = true
+	return
+}
+
+// checkLdapTLS returns "valid" or the reason why the certificate cannot be verified
+func checkLdapTLS(c ldapCandidate, timeout time.Duration) string {
+	tc, err := ldapTLSConfig(c.Host)
+	if err != nil {
+		return "invalid: " + err.Error()
+	}
+	// always verify here, --ldap.insecure is applied by the caller
+	tc.InsecureSkipVerify = false
+	if c.StartTLS {
+		conn, e := dialLdap(c, tc)
+		if e != nil {
+			return "invalid: " + e.Error()
+		}
+		_ = conn.Close()
+		return "valid"
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", c.address(), tc)
+	if err != nil {
+		return "invalid: " + err.Error()
+	}
+	_ = conn.Close()
+	return "valid"
+}
+
+// fastestLdapServer returns the connection of the healthy server with the shortest
+// connect time and closes all others
+func fastestLdapServer(probes []ldapProbe) (best *ldapProbe) {
+	order := make([]int, len(probes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return probes[order[a]].connect < probes[order[b]].connect
+	})
+	for _, i := range order {
+		p := &probes[i]
+		if best == nil && p.Healthy {
+			best = p
+			continue
+		}
+		if p.lc != nil && p.lc.Conn != nil {
+			_ = p.lc.Conn.Close()
+		}
+	}
+	return
+}
+
+// writeLdapStatus prints the probes as table
+func writeLdapStatus(w io.Writer, probes []ldapProbe) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SERVER\tPORT\tSOURCE\tTCP\tTLS\tBIND\tCONTEXT\tCONNECT\tSTATUS")
+	for _, p := range probes {
+		status := "healthy"
+		if !p.Healthy {
+			status = "failed: " + p.Error
+		}
+		ctx := p.Context
+		if ctx == "" {
+			ctx = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%dms\t%s\n",
+			p.Server, p.Port, p.Source, okValue(p.Reachable), p.TLSStatus, okValue(p.Bind), ctx, p.ConnectMS, status)
+	}
+	err = tw.Flush()
+	return
+}
+
+func okValue(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "failed"
+}
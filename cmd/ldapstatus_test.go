@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestLdapStatus(t *testing.T) {
+	servers := []dblib.LdapServer{{Hostname: "oid1", Port: 389, SSLPort: 636}, {Hostname: "oid2", Port: 1389}}
+	saveServer, savePort, saveTLS := ldapServer, ldapPort, ldapTLS
+	defer func() {
+		ldapServer, ldapPort, ldapTLS, ldapStartTLS = saveServer, savePort, saveTLS, false
+	}()
+
+	t.Run("candidates", func(t *testing.T) {
+		ldapServer, ldapPort, ldapTLS = "", 0, false
+		c := ldapCandidates(servers, false)
+		assert.Equal(t, []ldapCandidate{
+			{Host: "oid1", Port: 636, TLS: true, Source: sourceLdapOra},
+			{Host: "oid2", Port: 1389, Source: sourceLdapOra},
+		}, c, "ldap.ora candidates not expected")
+
+		ldapServer, ldapPort, ldapTLS = "ldap1, ldap2", 0, true
+		c = ldapCandidates(servers, false)
+		assert.Equal(t, []ldapCandidate{
+			{Host: "ldap1", TLS: true, Source: sourceFlag},
+			{Host: "ldap2", TLS: true, Source: sourceFlag},
+		}, c, "flag candidates not expected")
+		assert.Equal(t, "ldap1:636", c[0].address(), "default TLS port expected")
+		assert.Equal(t, 4, len(ldapCandidates(servers, true)), "status should probe all servers")
+	})
+	t.Run("starttls candidates", func(t *testing.T) {
+		ldapServer, ldapPort, ldapTLS, ldapStartTLS = "", 0, false, true
+		c := ldapCandidates(append(servers, dblib.LdapServer{Hostname: "oid3", SSLPort: 636}), false)
+		ldapStartTLS = false
+		assert.Equal(t, []ldapCandidate{
+			{Host: "oid1", Port: 389, StartTLS: true, Source: sourceLdapOra},
+			{Host: "oid2", Port: 1389, StartTLS: true, Source: sourceLdapOra},
+			{Host: "oid3", Port: 636, TLS: true, Source: sourceLdapOra},
+		}, c, "StartTLS should use the plain ldap.ora port")
+		assert.Equal(t, "oid1:389", c[0].address())
+	})
+	t.Run("starttls refused", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoErrorf(t, err, "listen failed: %s", err)
+		defer func() { _ = l.Close() }()
+		go func() {
+			for {
+				conn, e := l.Accept()
+				if e != nil {
+					return
+				}
+				_ = conn.Close()
+			}
+		}()
+		port := l.Addr().(*net.TCPAddr).Port
+		_, err = dialLdap(ldapCandidate{Host: "127.0.0.1", Port: port, StartTLS: true}, &tls.Config{MinVersion: tls.VersionTLS12})
+		assert.ErrorContains(t, err, "StartTLS refused by 127.0.0.1:")
+		p := probeLdapServer(ldapCandidate{Host: "127.0.0.1", Port: port, StartTLS: true, Source: sourceFlag})
+		assert.True(t, p.Reachable, "port should be reachable")
+		assert.Contains(t, p.TLSStatus, "invalid: StartTLS refused", "refused upgrade should be reported")
+		assert.False(t, p.Healthy, "refused upgrade should not be healthy")
+	})
+	t.Run("unreachable", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoErrorf(t, err, "listen failed: %s", err)
+		port := l.Addr().(*net.TCPAddr).Port
+		_ = l.Close()
+		p := probeLdapServer(ldapCandidate{Host: "127.0.0.1", Port: port, Source: sourceFlag})
+		assert.False(t, p.Reachable, "closed port should not be reachable")
+		assert.False(t, p.Healthy, "closed port should not be healthy")
+		assert.NotEmpty(t, p.Error, "error expected")
+	})
+	t.Run("fastest", func(t *testing.T) {
+		probes := []ldapProbe{
+			{Server: "slow", Healthy: true, connect: 30 * time.Millisecond},
+			{Server: "broken", Healthy: false, connect: time.Millisecond},
+			{Server: "fast", Healthy: true, connect: 10 * time.Millisecond},
+		}
+		best := fastestLdapServer(probes)
+		require.NotNil(t, best, "healthy server expected")
+		assert.Equal(t, "fast", best.Server, "fastest healthy server expected")
+		assert.Nil(t, fastestLdapServer(probes[1:2]), "no healthy server expected")
+	})
+	t.Run("table", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeLdapStatus(&sb, []ldapProbe{
+			{Server: "oid1", Port: 1636, Source: sourceLdapOra, Reachable: true, TLS: true, TLSStatus: "valid", Bind: true, Context: "cn=OracleContext,dc=oracle,dc=local", ConnectMS: 12, Healthy: true},
+			{Server: "oid2", Port: 1389, Source: sourceLdapOra, TLSStatus: "-", Error: "connection refused"},
+		})
+		require.NoErrorf(t, err, "write status failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Equal(t, 3, len(lines), "header and 2 lines expected")
+		assert.Equal(t, []string{"oid1", "1636", "ldap.ora", "ok", "valid", "ok", "cn=OracleContext,dc=oracle,dc=local", "12ms", "healthy"}, strings.Fields(lines[1]))
+		assert.Contains(t, lines[2], "failed: connection refused")
+	})
+}
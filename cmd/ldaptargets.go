@@ -0,0 +1,232 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+// ldapTarget is one Oracle Context synced by ldap write
+type ldapTarget struct {
+	Name    string `mapstructure:"name"`
+	Context string `mapstructure:"context"`
+	// Source is the tnsnames.ora file, default is --ldap.tnssource
+	Source string `mapstructure:"source"`
+	// Filter is a regex selecting the aliases of the source
+	Filter string `mapstructure:"filter"`
+	// Aliases is the alias mapping file, default is --aliases
+	Aliases string `mapstructure:"aliases"`
+}
+
+// targetResult is the outcome of syncing one target
+type targetResult struct {
+	Target ldapTarget
+	Status TWorkStatus
+	Err    error
+	Run    bool
+}
+
+var ldapWriteTargetNames []string
+var ldapContinueOnError = false
+
+func init() {
+	ldapWriteCmd.Flags().StringSliceVar(&ldapWriteTargetNames, "target", nil, "names of the configured ldap.targets to write, default all")
+	ldapWriteCmd.Flags().BoolVar(&ldapContinueOnError, "continue-on-error", false, "continue with the next target if one fails")
+}
+
+// loadLdapTargets returns the configured ldap.targets selected by --target
+func loadLdapTargets() (targets []ldapTarget, err error) {
+	var all []ldapTarget
+	if err = viper.UnmarshalKey("ldap.targets", &all); err != nil {
+		err = fmt.Errorf("invalid ldap.targets: %v", err)
+		return
+	}
+	names := map[string]bool{}
+	for i, t := range all {
+		switch {
+		case t.Name == "":
+			err = fmt.Errorf("ldap.targets entry %d has no name", i+1)
+		case t.Context == "":
+			err = fmt.Errorf("ldap target %s has no context", t.Name)
+		case names[t.Name]:
+			err = fmt.Errorf("ldap target %s defined twice", t.Name)
+		}
+		if err != nil {
+			return
+		}
+		names[t.Name] = true
+		if len(ldapWriteTargetNames) == 0 || slices.Contains(ldapWriteTargetNames, t.Name) {
+			targets = append(targets, t)
+		}
+	}
+	for _, n := range ldapWriteTargetNames {
+		if !names[n] {
+			err = fmt.Errorf("ldap target %s not configured", n)
+			return
+		}
+	}
+	return
+}
+
+// ldapWriteTargets syncs all targets over one connection and prints a summary per context
+func ldapWriteTargets(targets []ldapTarget) (err error) {
+	lc, err := ldapConnectServer()
+	if err != nil {
+		return
+	}
+	results := make([]targetResult, len(targets))
+	failed := 0
+	for i, t := range targets {
+		results[i].Target = t
+		if failed > 0 && !ldapContinueOnError {
+			continue
+		}
+		results[i].Run = true
+		contextDN = t.Context
+		if ldapDryRun {
+			fmt.Printf("# target %s (%s)\n", t.Name, t.Context)
+		}
+		err = selectOracleContext(lc)
+		if err == nil {
+			t.Context = contextDN
+			results[i].Status, err = writeLdapTarget(lc, t)
+		}
+		if err == nil && results[i].Status[sSkip] > 0 {
+			err = fmt.Errorf("%d aliases skipped because of errors", results[i].Status[sSkip])
+		}
+		if err != nil {
+			log.Errorf("target %s failed: %v", t.Name, err)
+			results[i].Err = err
+			failed++
+		}
+	}
+	err = writeTargetSummary(os.Stdout, results)
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d of %d ldap targets failed", failed, len(targets))
+	}
+	return
+}
+
+// withDefaults fills source and aliases not configured for the target from the command line
+func (t ldapTarget) withDefaults() ldapTarget {
+	if t.Source == "" {
+		t.Source = filename
+	}
+	if t.Aliases == "" {
+		t.Aliases = ldapAliasFile
+	}
+	return t
+}
+
+// writeLdapTarget plans the sync of one context and applies it unless --dry-run is set
+func writeLdapTarget(lc *ldaplib.LdapConfigType, t ldapTarget) (workStatus TWorkStatus, err error) {
+	t = t.withDefaults()
+	source := t.Source
+	tnsEntries, domain, err := dblib.GetTnsnames(source, true)
+	if err == nil && len(tnsEntries) == 0 {
+		err = fmt.Errorf("no Entries found")
+	}
+	if err != nil {
+		err = fmt.Errorf("load %s failed: %v", source, err)
+		return
+	}
+	if tnsEntries, err = filterTargetEntries(tnsEntries, t.Filter); err != nil {
+		return
+	}
+	log.Infof("Update LDAP Context %s with %d tnsnames.ora entries using domain %s", t.Context, len(tnsEntries), domain)
+	keep := ldapFlagKeepOptions()
+	plan, workStatus, err := planLdapTns(lc, tnsEntries, domain, t.Context, keep)
+	if err == nil && t.Aliases != "" {
+		var aliasPlan []ldapPlanItem
+		aliasPlan, err = planLdapAliases(lc, t.Context, t.Aliases, domain, plan, keep)
+		plan = append(plan, aliasPlan...)
+		for _, item := range aliasPlan {
+			workStatus[item.Action]++
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("write to ldap failed: %v", err)
+		return
+	}
+	if ldapLdifOut != "" {
+		file := targetFile(ldapLdifOut, t.Name)
+		var sb strings.Builder
+		_ = writeLdifChanges(&sb, plan)
+		if err = common.WriteStringToFile(file, sb.String()); err != nil {
+			err = fmt.Errorf("cannot write %s: %v", file, err)
+			return
+		}
+		log.Infof("LDIF changes written to %s", file)
+	}
+	if ldapDryRun {
+		err = writeLdapPlan(os.Stdout, plan)
+		return
+	}
+	if _, err = backupLdapTns(lc, t.Context); err != nil {
+		return
+	}
+	// write to ldap
+	workStatus, err = applyLdapPlan(lc, t.Context, plan)
+	return
+}
+
+// filterTargetEntries keeps the entries with an alias matching the filter regex
+func filterTargetEntries(tnsEntries dblib.TNSEntries, filter string) (filtered dblib.TNSEntries, err error) {
+	if filter == "" {
+		return tnsEntries, nil
+	}
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		err = fmt.Errorf("invalid filter '%s': %v", filter, err)
+		return
+	}
+	filtered = dblib.TNSEntries{}
+	for k, e := range tnsEntries {
+		if re.MatchString(e.Name) {
+			filtered[k] = e
+		}
+	}
+	if len(filtered) == 0 {
+		err = fmt.Errorf("no entries match filter '%s'", filter)
+	}
+	return
+}
+
+// targetFile adds the target name to a file name, x.ldif becomes x_name.ldif
+func targetFile(file string, name string) string {
+	if name == "" {
+		return file
+	}
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "_" + name + ext
+}
+
+// writeTargetSummary prints the work status of every target
+func writeTargetSummary(w io.Writer, results []targetResult) (err error) {
+	var sb strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&sb, "%s %s: ", r.Target.Name, r.Target.Context)
+		switch {
+		case !r.Run:
+			sb.WriteString("not run\n")
+		case r.Err != nil:
+			fmt.Fprintf(&sb, "failed: %v\n", r.Err)
+		default:
+			s := r.Status
+			fmt.Fprintf(&sb, "%d ok, %d new, %d mod, %d del, %d keep, %d skip\n", s[sOK], s[sNew], s[sMod], s[sDel], s[sKeep], s[sSkip])
+		}
+	}
+	_, err = io.WriteString(w, sb.String())
+	return
+}
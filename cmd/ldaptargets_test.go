@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestLdapTargets(t *testing.T) {
+	defer func() {
+		viper.Set("ldap.targets", nil)
+		ldapWriteTargetNames = nil
+	}()
+	t.Run("load targets", func(t *testing.T) {
+		viper.Set("ldap.targets", []map[string]any{
+			{"name": "dev", "context": "cn=OracleContext,dc=dev,dc=local", "source": "dev.ora"},
+			{"name": "prod", "context": "cn=OracleContext,dc=prod,dc=local", "filter": "^P"},
+		})
+		targets, err := loadLdapTargets()
+		require.NoErrorf(t, err, "load targets failed: %s", err)
+		require.Equal(t, 2, len(targets), "2 targets expected")
+		assert.Equal(t, ldapTarget{Name: "dev", Context: "cn=OracleContext,dc=dev,dc=local", Source: "dev.ora"}, targets[0])
+		assert.Equal(t, "^P", targets[1].Filter)
+
+		ldapWriteTargetNames = []string{"prod"}
+		targets, err = loadLdapTargets()
+		require.NoErrorf(t, err, "load targets failed: %s", err)
+		require.Equal(t, 1, len(targets), "1 target expected")
+		assert.Equal(t, "prod", targets[0].Name)
+
+		ldapWriteTargetNames = []string{"test"}
+		_, err = loadLdapTargets()
+		assert.ErrorContains(t, err, "test not configured")
+		ldapWriteTargetNames = nil
+	})
+	t.Run("invalid targets", func(t *testing.T) {
+		viper.Set("ldap.targets", []map[string]any{{"name": "dev"}})
+		_, err := loadLdapTargets()
+		assert.ErrorContains(t, err, "no context")
+		viper.Set("ldap.targets", []map[string]any{{"name": "dev", "context": "c"}, {"name": "dev", "context": "c"}})
+		_, err = loadLdapTargets()
+		assert.ErrorContains(t, err, "defined twice")
+	})
+	t.Run("no targets", func(t *testing.T) {
+		viper.Set("ldap.targets", nil)
+		targets, err := loadLdapTargets()
+		require.NoErrorf(t, err, "load targets failed: %s", err)
+		assert.Empty(t, targets)
+	})
+	t.Run("filter", func(t *testing.T) {
+		entries := dblib.TNSEntries{"P1.local": {Name: "P1.local"}, "D1.local": {Name: "D1.local"}}
+		filtered, err := filterTargetEntries(entries, "^P")
+		require.NoErrorf(t, err, "filter failed: %s", err)
+		assert.Equal(t, dblib.TNSEntries{"P1.local": {Name: "P1.local"}}, filtered)
+		_, err = filterTargetEntries(entries, "^X")
+		assert.ErrorContains(t, err, "no entries match")
+		_, err = filterTargetEntries(entries, "(")
+		assert.ErrorContains(t, err, "invalid filter")
+	})
+	t.Run("defaults", func(t *testing.T) {
+		file, aliases := filename, ldapAliasFile
+		defer func() { filename, ldapAliasFile = file, aliases }()
+		filename, ldapAliasFile = "all.ora", "aliases.txt"
+		assert.Equal(t, ldapTarget{Name: "dev", Source: "all.ora", Aliases: "aliases.txt"}, ldapTarget{Name: "dev"}.withDefaults(), "command line defaults expected")
+		own := ldapTarget{Name: "prod", Source: "prod.ora", Aliases: "prod_aliases.txt"}
+		assert.Equal(t, own, own.withDefaults(), "configured files should be kept")
+	})
+	t.Run("target file", func(t *testing.T) {
+		assert.Equal(t, "changes_dev.ldif", targetFile("changes.ldif", "dev"))
+		assert.Equal(t, "/tmp/changes", targetFile("/tmp/changes", ""))
+	})
+	t.Run("summary", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeTargetSummary(&sb, []targetResult{
+			{Target: ldapTarget{Name: "dev", Context: "ctx1"}, Run: true, Status: TWorkStatus{sOK: 1, sNew: 2}},
+			{Target: ldapTarget{Name: "test", Context: "ctx2"}, Run: true, Err: errors.New("bind failed")},
+			{Target: ldapTarget{Name: "prod", Context: "ctx3"}},
+		})
+		require.NoErrorf(t, err, "write summary failed: %s", err)
+		assert.Equal(t, "dev ctx1: 1 ok, 2 new, 0 mod, 0 del, 0 keep, 0 skip\ntest ctx2: failed: bind failed\nprod ctx3: not run\n", sb.String())
+	})
+}
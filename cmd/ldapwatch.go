@@ -0,0 +1,241 @@
+// Package cmd commands
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+var ldapWatch = false
+var ldapWatchInterval = 5 * time.Minute
+var ldapWatchHook = ""
+
+// tnsWatcher regenerates the target file when the Oracle Context changed
+type tnsWatcher struct {
+	target      string
+	hook        string
+	lc          *ldaplib.LdapConfigType
+	fingerprint string
+}
+
+func init() {
+	ldapReadCmd.Flags().BoolVar(&ldapWatch, "watch", false, "keep running and update --ldap.tnstarget when LDAP changes")
+	ldapReadCmd.Flags().DurationVar(&ldapWatchInterval, "interval", ldapWatchInterval, "poll interval of --watch")
+	ldapReadCmd.Flags().StringVar(&ldapWatchHook, "hook", "", "shell command to run after --watch updated the target")
+}
+
+// checkWatchFlags verifies the watch options
+func checkWatchFlags(target string) error {
+	if !ldapWatch {
+		if ldapWatchHook != "" {
+			return fmt.Errorf("--hook needs --watch")
+		}
+		return nil
+	}
+	switch {
+	case target == "":
+		return fmt.Errorf("--watch needs --ldap.tnstarget")
+	case tnsSplit:
+		return fmt.Errorf("--watch cannot be used with --split")
+	case ldapWatchInterval < time.Second:
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+	return nil
+}
+
+// watchLdapTns writes the target and keeps it in sync until interrupted
+func watchLdapTns(lc *ldaplib.LdapConfigType, target string) (err error) {
+	w := &tnsWatcher{target: target, hook: ldapWatchHook, lc: lc}
+	if _, err = w.poll(); err != nil {
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Infof("watch %s every %s, target %s", contextDN, ldapWatchInterval, target)
+	w.run(ctx, ldapWatchInterval)
+	log.Info("watch stopped")
+	return
+}
+
+// run polls LDAP at every interval until ctx is canceled
+func (w *tnsWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := w.poll(); err != nil {
+			log.Warnf("update %s failed, keep previous version: %v", w.target, err)
+		}
+	}
+}
+
+// poll regenerates the target if the fingerprint of the context changed.
+// A failed connection is dropped and opened again on the next poll
+func (w *tnsWatcher) poll() (changed bool, err error) {
+	if w.lc == nil {
+		if w.lc, err = ldapConnect(); err != nil {
+			w.lc = nil
+			return
+		}
+	}
+	fp, err := ldapFingerprint(w.lc, contextDN)
+	if err != nil {
+		if w.lc.Conn != nil {
+			_ = w.lc.Conn.Close()
+		}
+		w.lc = nil
+		return
+	}
+	if fp == w.fingerprint {
+		log.Debugf("context %s unchanged", contextDN)
+		return
+	}
+	var buf bytes.Buffer
+	n, err := renderLdapTns(w.lc, &buf)
+	if err != nil {
+		return
+	}
+	changed, err = writeWatchTarget(w.target, buf.Bytes(), n)
+	if err != nil {
+		return
+	}
+	w.fingerprint = fp
+	if !changed {
+		log.Debugf("%s is up to date", w.target)
+		return
+	}
+	log.Infof("%s updated with %d LDAP entries", w.target, n)
+	if w.hook != "" {
+		runWatchHook(w.hook, w.target)
+	}
+	return
+}
+
+// ldapFingerprint summarizes the state of the context by the number of entries,
+// the latest modifyTimestamp and the contextCSN of the base if available
+func ldapFingerprint(lc *ldaplib.LdapConfigType, contextDN string) (fp string, err error) {
+	entries, err := lc.Search(contextDN, ldapSearchFilter("", false), []string{"modifyTimestamp"}, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases)
+	if err != nil {
+		err = fmt.Errorf("poll %s failed: %v", contextDN, err)
+		return
+	}
+	base := ldapBaseDN
+	if base == "" {
+		base = contextDN
+	}
+	csn := ""
+	// contextCSN is only maintained by servers with replication enabled
+	if r, e := lc.Search(base, "(objectClass=*)", []string{"contextCSN"}, ldap.ScopeBaseObject, ldap.NeverDerefAliases); e == nil && len(r) > 0 {
+		csn = strings.Join(r[0].GetAttributeValues("contextCSN"), ",")
+	}
+	fp = fingerprintOf(entries, csn)
+	log.Debugf("fingerprint of %s: %s", contextDN, fp)
+	return
+}
+
+func fingerprintOf(entries []*ldap.Entry, csn string) string {
+	latest := ""
+	for _, e := range entries {
+		// generalized times in UTC sort as strings
+		if ts := e.GetAttributeValue("modifyTimestamp"); ts > latest {
+			latest = ts
+		}
+	}
+	return fmt.Sprintf("%d|%s|%s", len(entries), latest, csn)
+}
+
+// writeWatchTarget writes the rendered content of n entries with writeIfChanged. An empty
+// context never replaces a non-empty target, as a wrong context, an ACL change or an
+// unfinished clear would remove all aliases from the clients
+func writeWatchTarget(file string, content []byte, n int) (changed bool, err error) {
+	if n == 0 {
+		if fi, e := os.Stat(file); e == nil && fi.Size() > 0 {
+			log.Warnf("no entries found in %s, keep previous version of %s", contextDN, file)
+			return
+		}
+	}
+	return writeIfChanged(file, content)
+}
+
+// writeIfChanged replaces file with content using a temp file and rename if the
+// content differs. The previous version is kept as file.bak
+func writeIfChanged(file string, content []byte) (changed bool, err error) {
+	//nolint gosec
+	old, readErr := os.ReadFile(file)
+	if readErr == nil && bytes.Equal(old, content) {
+		return
+	}
+	mode := os.FileMode(0644)
+	if fi, e := os.Stat(file); e == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		err = fmt.Errorf("cannot create temp file: %v", err)
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot write temp file: %v", err)
+		return
+	}
+	if readErr == nil {
+		if err = os.WriteFile(file+".bak", old, mode); err != nil {
+			err = fmt.Errorf("cannot write backup: %v", err)
+			return
+		}
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		err = fmt.Errorf("cannot replace %s: %v", file, err)
+		return
+	}
+	changed = true
+	return
+}
+
+// runWatchHook runs the hook with the shell, failures are logged only
+func runWatchHook(hook string, target string) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	//nolint gosec
+	c := exec.Command(shell, flag, hook)
+	c.Env = append(os.Environ(), "TNSCLI_TARGET="+target, "TNSCLI_CONTEXT="+contextDN)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		log.Warnf("hook '%s' failed: %v: %s", hook, err, strings.TrimSpace(string(out)))
+		return
+	}
+	log.Infof("hook '%s' finished: %s", hook, strings.TrimSpace(string(out)))
+}
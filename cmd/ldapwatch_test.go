@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLdapWatch(t *testing.T) {
+	dir := t.TempDir()
+	target := path.Join(dir, "tnsnames.ora")
+	defer func() {
+		ldapWatch, ldapWatchHook, ldapWatchInterval, tnsSplit = false, "", 5*time.Minute, false
+	}()
+
+	t.Run("flags", func(t *testing.T) {
+		ldapWatch, ldapWatchHook = false, "true"
+		assert.ErrorContains(t, checkWatchFlags(target), "--hook needs --watch")
+		ldapWatch = true
+		assert.ErrorContains(t, checkWatchFlags(""), "needs --ldap.tnstarget")
+		tnsSplit = true
+		assert.ErrorContains(t, checkWatchFlags(target), "--split")
+		tnsSplit = false
+		ldapWatchInterval = 0
+		assert.ErrorContains(t, checkWatchFlags(target), "at least 1s")
+		ldapWatchInterval = time.Minute
+		assert.NoError(t, checkWatchFlags(target))
+		ldapWatch, ldapWatchHook = false, ""
+	})
+	t.Run("fingerprint", func(t *testing.T) {
+		entries := []*ldap.Entry{
+			ldap.NewEntry("cn=a", map[string][]string{"modifyTimestamp": {"20261001120000Z"}}),
+			ldap.NewEntry("cn=b", map[string][]string{"modifyTimestamp": {"20261002120000Z"}}),
+			ldap.NewEntry("cn=c", map[string][]string{}),
+		}
+		assert.Equal(t, "3|20261002120000Z|", fingerprintOf(entries, ""))
+		assert.Equal(t, "2|20261002120000Z|csn", fingerprintOf(entries[:2], "csn"), "deleted entry should change fingerprint")
+	})
+	t.Run("write if changed", func(t *testing.T) {
+		changed, err := writeIfChanged(target, []byte("XE=(DESCRIPTION=(v1))\n"))
+		require.NoErrorf(t, err, "write failed: %s", err)
+		assert.True(t, changed, "new file should be written")
+		assert.NoFileExists(t, target+".bak", "no backup for a new file")
+
+		changed, err = writeIfChanged(target, []byte("XE=(DESCRIPTION=(v1))\n"))
+		require.NoErrorf(t, err, "write failed: %s", err)
+		assert.False(t, changed, "same content should not be written")
+
+		require.NoError(t, os.Chmod(target, 0640))
+		changed, err = writeIfChanged(target, []byte("XE=(DESCRIPTION=(v2))\n"))
+		require.NoErrorf(t, err, "write failed: %s", err)
+		assert.True(t, changed, "changed content should be written")
+		c, _ := os.ReadFile(target)
+		assert.Equal(t, "XE=(DESCRIPTION=(v2))\n", string(c))
+		c, _ = os.ReadFile(target + ".bak")
+		assert.Equal(t, "XE=(DESCRIPTION=(v1))\n", string(c), "previous version should be kept")
+		fi, err := os.Stat(target)
+		require.NoError(t, err)
+		if runtime.GOOS != "windows" {
+			assert.Equal(t, os.FileMode(0640), fi.Mode().Perm(), "file mode should be kept")
+		}
+		left, _ := os.ReadDir(dir)
+		assert.Len(t, left, 2, "temp file should be renamed")
+	})
+	t.Run("keep target on empty context", func(t *testing.T) {
+		file := path.Join(t.TempDir(), "tnsnames.ora")
+		changed, err := writeWatchTarget(file, nil, 0)
+		require.NoErrorf(t, err, "write failed: %s", err)
+		assert.True(t, changed, "missing target should be created")
+		changed, err = writeWatchTarget(file, []byte("XE=(DESCRIPTION=(v1))\n"), 1)
+		require.NoErrorf(t, err, "write failed: %s", err)
+		assert.True(t, changed, "entries should be written")
+		changed, err = writeWatchTarget(file, nil, 0)
+		require.NoErrorf(t, err, "empty render should not fail: %s", err)
+		assert.False(t, changed, "empty render should not replace the target")
+		c, _ := os.ReadFile(file)
+		assert.Equal(t, "XE=(DESCRIPTION=(v1))\n", string(c), "previous version should be kept")
+	})
+	t.Run("hook", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("hook test uses sh")
+		}
+		marker := path.Join(dir, "hook.txt")
+		runWatchHook("echo $TNSCLI_TARGET > "+marker, target)
+		c, err := os.ReadFile(marker)
+		require.NoErrorf(t, err, "hook did not run: %s", err)
+		assert.Equal(t, target+"\n", string(c))
+		runWatchHook("exit 1", target)
+	})
+}
@@ -0,0 +1,263 @@
+// Package cmd commands
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+// ldifWidth is the maximum line length before a LDIF line is folded
+const ldifWidth = 76
+
+const attrDescString = "orclNetDescString"
+
+// ldifLine formats one attribute line. Values which are not safe strings
+// according to RFC 2849 are base64 encoded
+func ldifLine(attr string, value string) string {
+	line := attr + ": " + value
+	if !ldifSafe(value) {
+		line = attr + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return ldifFold(line)
+}
+
+// ldifSafe reports if a value can be written as plain LDIF string
+func ldifSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// ldifFold wraps a line at ldifWidth, continuation lines start with a space
+func ldifFold(line string) string {
+	if len(line) <= ldifWidth {
+		return line
+	}
+	var sb strings.Builder
+	sb.WriteString(line[:ldifWidth])
+	for rest := line[ldifWidth:]; rest != ""; {
+		n := min(len(rest), ldifWidth-1)
+		sb.WriteString("\n ")
+		sb.WriteString(rest[:n])
+		rest = rest[n:]
+	}
+	return sb.String()
+}
+
+// ldifDN returns the DN of an entry, or builds it from the alias below contextDN
+func ldifDN(e dblib.TNSEntry, contextDN string) string {
+	if strings.HasPrefix(strings.ToLower(e.Location), "cn=") {
+		return e.Location
+	}
+	return serviceDN(e.Name, contextDN)
+}
+
+// writeLdifEntries prints the TNS entries as orclNetService LDIF content records
+func writeLdifEntries(w io.Writer, tnsEntries dblib.TNSEntries, contextDN string) (err error) {
+	var sb strings.Builder
+	sb.WriteString("version: 1\n")
+	for _, alias := range getSortedAliases(tnsEntries) {
+		e := tnsEntries[alias]
+		sb.WriteString("\n")
+		for _, l := range []string{
+			ldifLine("dn", ldifDN(e, contextDN)),
+			ldifLine("objectClass", "top"),
+			ldifLine("objectClass", "orclNetService"),
+			ldifLine("cn", e.Name),
+			ldifLine(attrDescString, e.Desc),
+		} {
+			sb.WriteString(l + "\n")
+		}
+	}
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+// writeLdifChanges prints the add, modify and delete operations of a plan as LDIF change records
+func writeLdifChanges(w io.Writer, plan []ldapPlanItem) (err error) {
+	var sb strings.Builder
+	sb.WriteString("version: 1\n")
+	for _, item := range plan {
+		var lines []string
+		switch {
+		case item.AliasOf != "":
+			lines = ldifAliasChange(item)
+			if lines == nil {
+				continue
+			}
+		case item.Action == sNew:
+			lines = []string{
+				ldifLine("changetype", "add"),
+				ldifLine("objectClass", "top"),
+				ldifLine("objectClass", "orclNetService"),
+				ldifLine("cn", item.Alias),
+				ldifLine(attrDescString, item.desc),
+			}
+		case item.Action == sMod:
+			lines = []string{
+				ldifLine("changetype", "modify"),
+				ldifLine("replace", attrDescString),
+				ldifLine(attrDescString, item.desc),
+				"-",
+			}
+		case item.Action == sDel:
+			lines = []string{ldifLine("changetype", "delete")}
+		default:
+			continue
+		}
+		fmt.Fprintf(&sb, "\n# %s %s\n%s\n", item.Action, item.Alias, ldifLine("dn", item.DN))
+		sb.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+// ldifAliasChange returns the change record lines of an alias object, nil if unchanged
+func ldifAliasChange(item ldapPlanItem) []string {
+	switch item.Action {
+	case sNew:
+		return []string{
+			ldifLine("changetype", "add"),
+			ldifLine("objectClass", "top"),
+			ldifLine("objectClass", "alias"),
+			ldifLine("objectClass", classNetServiceAlias),
+			ldifLine("cn", item.Alias),
+			ldifLine(attrAliasedObject, item.AliasOf),
+		}
+	case sMod:
+		return []string{
+			ldifLine("changetype", "modify"),
+			ldifLine("replace", attrAliasedObject),
+			ldifLine(attrAliasedObject, item.AliasOf),
+			"-",
+		}
+	case sDel:
+		return []string{ldifLine("changetype", "delete")}
+	}
+	return nil
+}
+
+// writeLdifAliases prints orclNetServiceAlias objects as LDIF content records
+func writeLdifAliases(w io.Writer, aliases []ldapAlias) (err error) {
+	var sb strings.Builder
+	for _, a := range aliases {
+		sb.WriteString("\n")
+		for _, l := range []string{
+			ldifLine("dn", a.DN),
+			ldifLine("objectClass", "top"),
+			ldifLine("objectClass", "alias"),
+			ldifLine("objectClass", classNetServiceAlias),
+			ldifLine("cn", a.Name),
+			ldifLine(attrAliasedObject, a.Target),
+		} {
+			sb.WriteString(l + "\n")
+		}
+	}
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+// readLdifRecords parses LDIF content records into TNS entries keyed by cn and
+// orclNetServiceAlias objects. Records with neither orclNetDescString nor
+// aliasedObjectName are ignored
+func readLdifRecords(content string) (entries dblib.TNSEntries, aliases []ldapAlias, err error) {
+	entries = dblib.TNSEntries{}
+	var lines []string
+	lineNo := 0
+	startLine := 0
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		entry := dblib.TNSEntry{}
+		target := ""
+		for _, l := range lines {
+			attr, value, e := ldifAttr(l)
+			if e != nil {
+				return fmt.Errorf("line %d: %v", startLine, e)
+			}
+			switch strings.ToLower(attr) {
+			case "dn":
+				entry.Location = value
+			case "cn":
+				entry.Name = value
+			case strings.ToLower(attrDescString):
+				entry.Desc = value
+			case strings.ToLower(attrAliasedObject):
+				target = value
+			}
+		}
+		lines = nil
+		switch {
+		case entry.Name == "":
+		case entry.Desc != "":
+			entries[entry.Name] = entry
+		case target != "":
+			aliases = append(aliases, ldapAlias{Name: entry.Name, DN: entry.Location, Target: target})
+		}
+		return nil
+	}
+	for _, l := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		lineNo++
+		switch {
+		case strings.HasPrefix(l, " "):
+			if len(lines) > 0 {
+				lines[len(lines)-1] += l[1:]
+			}
+		case strings.HasPrefix(l, "#"):
+		case l == "":
+			if err = flush(); err != nil {
+				return
+			}
+		default:
+			if len(lines) == 0 {
+				startLine = lineNo
+			}
+			lines = append(lines, l)
+		}
+	}
+	err = flush()
+	return
+}
+
+// ldifAttr splits an unfolded LDIF line into attribute and decoded value
+func ldifAttr(line string) (attr string, value string, err error) {
+	attr, value, found := strings.Cut(line, ":")
+	if !found {
+		err = fmt.Errorf("missing ':' in '%s'", line)
+		return
+	}
+	switch {
+	case strings.HasPrefix(value, ":"):
+		var b []byte
+		b, err = base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			err = fmt.Errorf("invalid base64 value of %s: %v", attr, err)
+			return
+		}
+		value = string(b)
+	case strings.HasPrefix(value, "<"):
+		err = fmt.Errorf("URL values are not supported for %s", attr)
+	default:
+		value = strings.TrimLeft(value, " ")
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestLdif(t *testing.T) {
+	ctx := "cn=OracleContext," + LdapBaseDn
+	desc := "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=127.0.0.1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=XE)))"
+
+	t.Run("safe values", func(t *testing.T) {
+		assert.True(t, ldifSafe("cn=xe,"+ctx))
+		assert.True(t, ldifSafe(""))
+		assert.False(t, ldifSafe(" leading"))
+		assert.False(t, ldifSafe(":colon"))
+		assert.False(t, ldifSafe("trailing "))
+		assert.False(t, ldifSafe("multi\nline"))
+		assert.False(t, ldifSafe("umlaut ä"))
+	})
+	t.Run("base64 line", func(t *testing.T) {
+		v := "multi\nline"
+		assert.Equal(t, "description:: "+base64.StdEncoding.EncodeToString([]byte(v)), ldifLine("description", v))
+	})
+	t.Run("fold", func(t *testing.T) {
+		line := ldifLine(attrDescString, desc)
+		lines := strings.Split(line, "\n")
+		require.Greater(t, len(lines), 1, "long line should be folded")
+		for i, l := range lines {
+			assert.LessOrEqual(t, len(l), ldifWidth, "line too long")
+			if i > 0 {
+				assert.True(t, strings.HasPrefix(l, " "), "continuation must start with space")
+			}
+		}
+		unfolded := strings.ReplaceAll(line, "\n ", "")
+		assert.Equal(t, attrDescString+": "+desc, unfolded, "unfolded line not expected")
+	})
+	t.Run("entries", func(t *testing.T) {
+		entries := dblib.TNSEntries{
+			"xe":  {Name: "xe", Location: "cn=xe," + ctx, Desc: desc},
+			"abc": {Name: "abc", Desc: "(DESCRIPTION=(ADDRESS=(HOST=h)(PORT=1))(CONNECT_DATA=(SID=A)))"},
+		}
+		var sb strings.Builder
+		err := writeLdifEntries(&sb, entries, ctx)
+		require.NoErrorf(t, err, "write ldif failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.True(t, strings.HasPrefix(out, "version: 1\n\ndn: cn=abc,"+ctx+"\n"), "first entry not expected")
+		assert.Contains(t, out, "dn: cn=xe,"+ctx+"\nobjectClass: top\nobjectClass: orclNetService\ncn: xe\n")
+	})
+	t.Run("changes", func(t *testing.T) {
+		plan := []ldapPlanItem{
+			{Alias: "new", Action: sNew, DN: "cn=new," + ctx, desc: "(DESCRIPTION=(CONNECT_DATA=(SID=N)))"},
+			{Alias: "xe", Action: sOK, DN: "cn=xe," + ctx},
+			{Alias: "xe1", Action: sMod, DN: "cn=xe1," + ctx, desc: "(DESCRIPTION=(CONNECT_DATA=(SID=M)))"},
+			{Alias: "xe2", Action: sDel, DN: "cn=xe2," + ctx},
+			{Alias: "xe3", Action: sKeep, DN: "cn=xe3," + ctx},
+		}
+		var sb strings.Builder
+		err := writeLdifChanges(&sb, plan)
+		require.NoErrorf(t, err, "write ldif changes failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "# new new\ndn: cn=new,"+ctx+"\nchangetype: add\nobjectClass: top\nobjectClass: orclNetService\ncn: new\norclNetDescString: (DESCRIPTION=(CONNECT_DATA=(SID=N)))\n")
+		assert.Contains(t, out, "dn: cn=xe1,"+ctx+"\nchangetype: modify\nreplace: orclNetDescString\norclNetDescString: (DESCRIPTION=(CONNECT_DATA=(SID=M)))\n-\n")
+		assert.Contains(t, out, "dn: cn=xe2,"+ctx+"\nchangetype: delete\n")
+		assert.NotContains(t, out, "cn=xe,", "unchanged alias should not be written")
+		assert.NotContains(t, out, "xe3", "kept alias should not be written")
+	})
+	t.Run("read entries", func(t *testing.T) {
+		entries := dblib.TNSEntries{
+			"xe":     {Name: "xe", Location: "cn=xe," + ctx, Desc: desc},
+			"multi":  {Name: "multi", Location: "cn=multi," + ctx, Desc: "(DESCRIPTION=\n  (CONNECT_DATA=(SID=A)))"},
+			"db.dom": {Name: "db.dom", Location: "cn=db.dom," + ctx, Desc: "(DESCRIPTION=(CONNECT_DATA=(SID=B)))"},
+		}
+		var sb strings.Builder
+		err := writeLdifEntries(&sb, entries, ctx)
+		require.NoErrorf(t, err, "write ldif failed: %s", err)
+		aliases := []ldapAlias{{Name: "ro", DN: "cn=ro," + ctx, Target: "cn=xe," + ctx}}
+		err = writeLdifAliases(&sb, aliases)
+		require.NoErrorf(t, err, "write ldif aliases failed: %s", err)
+		actual, actualAliases, err := readLdifRecords(sb.String() + "\n# comment\ndn: cn=noservice," + ctx + "\ncn: noservice\n")
+		require.NoErrorf(t, err, "read ldif failed: %s", err)
+		assert.Equal(t, entries, actual, "entries should survive a round trip")
+		assert.Equal(t, aliases, actualAliases, "alias objects should survive a round trip")
+	})
+	t.Run("read errors", func(t *testing.T) {
+		_, _, err := readLdifRecords("dn: cn=a\ncn a\n")
+		assert.ErrorContains(t, err, "line 1:")
+		_, _, err = readLdifRecords("dn: cn=a\ncn:: ###\n")
+		assert.ErrorContains(t, err, "invalid base64")
+		_, _, err = readLdifRecords("dn: cn=a\ncn:< file:///etc/passwd\n")
+		assert.ErrorContains(t, err, "not supported")
+	})
+}
@@ -0,0 +1,271 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+var (
+	lintCmd = &cobra.Command{
+		Use:   "lint [files]",
+		Short: "validate tnsnames.ora files",
+		Long: `static check of tnsnames.ora files and their ifiles. Reports every problem with file, line,
+severity and rule id and exits non-zero if errors were found`,
+		RunE:         lintTns,
+		SilenceUsage: true,
+	}
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// lint rule ids
+const (
+	ruleLoad        = "TNS000"
+	ruleSyntax      = "TNS001"
+	ruleNoService   = "TNS002"
+	ruleInvalidPort = "TNS003"
+	ruleDuplicate   = "TNS004"
+	ruleInvalidHost = "TNS005"
+	ruleResolveHost = "TNS006"
+	ruleNoAddress   = "TNS007"
+	ruleIfile       = "TNS008"
+)
+
+var lintOutput = outputText
+var lintResolve = false
+
+// hostname labels or IPv4/IPv6 addresses
+var hostnameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
+
+// lintFinding is one problem found in a tnsnames.ora file
+type lintFinding struct {
+	File     string `json:"file" yaml:"file"`
+	Line     int    `json:"line" yaml:"line"`
+	Severity string `json:"severity" yaml:"severity"`
+	Rule     string `json:"rule" yaml:"rule"`
+	Alias    string `json:"alias,omitempty" yaml:"alias,omitempty"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// tnsLinter collects findings over a set of files
+type tnsLinter struct {
+	findings []lintFinding
+	seen     map[string]bool
+	aliases  map[string]lintFinding
+	resolve  bool
+	// load parses a file like all other commands do
+	load func(file string) error
+}
+
+func init() {
+	lintCmd.Flags().StringVarP(&lintOutput, "output", "o", lintOutput, "output format: text, json or yaml")
+	lintCmd.Flags().BoolVar(&lintResolve, "resolve", false, "warn about hosts which cannot be resolved by DNS")
+	RootCmd.AddCommand(lintCmd)
+}
+
+func lintTns(_ *cobra.Command, args []string) (err error) {
+	format, err := checkOutputFormat(lintOutput, outputText, outputJSON, outputYAML)
+	if err != nil {
+		return
+	}
+	files := args
+	if len(files) == 0 {
+		files = []string{filename}
+	}
+	l := newTnsLinter(lintResolve)
+	for _, f := range files {
+		log.Debugf("lint %s", f)
+		l.lintFile(f)
+	}
+	errors, warnings := l.counts()
+	l.sort()
+	if format == outputText {
+		err = l.write(os.Stdout)
+	} else {
+		err = writeStructured(os.Stdout, format, l.findings)
+	}
+	if err != nil {
+		return
+	}
+	log.Infof("%d files checked, %d errors, %d warnings", len(l.seen), errors, warnings)
+	if errors > 0 {
+		err = fmt.Errorf("%d errors found", errors)
+	}
+	return
+}
+
+func newTnsLinter(resolve bool) *tnsLinter {
+	return &tnsLinter{
+		findings: []lintFinding{},
+		seen:     map[string]bool{},
+		aliases:  map[string]lintFinding{},
+		resolve:  resolve,
+		load: func(file string) (err error) {
+			_, _, err = dblib.GetTnsnames(file, false)
+			return
+		},
+	}
+}
+
+func (l *tnsLinter) add(f lintFinding) {
+	l.findings = append(l.findings, f)
+}
+
+// lintFile checks one file with all included ifiles
+func (l *tnsLinter) lintFile(file string) {
+	if l.seen[file] {
+		return
+	}
+	l.seen[file] = true
+	// the file must be loadable by the same parser all other commands use,
+	// the load error is reported only if the scan finds no more specific error
+	// in this file, errors of included files do not explain it
+	loadErr := l.load(file)
+	start := len(l.findings)
+	defer func() {
+		if loadErr != nil && !hasError(l.findings[start:], file) {
+			l.add(lintFinding{File: file, Severity: severityError, Rule: ruleLoad, Message: fmt.Sprintf("cannot load file: %v", loadErr)})
+		}
+	}()
+	items, err := scanTnsFile(file)
+	if err != nil {
+		return
+	}
+	for _, it := range items {
+		switch it.Kind {
+		case itemIfile:
+			inc := ifilePath(it.Desc, file)
+			if _, serr := os.Stat(inc); serr != nil {
+				l.add(lintFinding{File: file, Line: it.Line, Severity: severityError, Rule: ruleIfile, Message: fmt.Sprintf("ifile %s not found", inc)})
+				continue
+			}
+			l.lintFile(inc)
+		case itemEntry:
+			l.lintEntry(it)
+		}
+	}
+}
+
+// hasError returns true if one of the findings is an error in file
+func hasError(findings []lintFinding, file string) bool {
+	for _, f := range findings {
+		if f.File == file && f.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+// lintEntry checks a single alias definition
+func (l *tnsLinter) lintEntry(it tnsItem) {
+	finding := func(line int, severity string, rule string, format string, args ...any) {
+		l.add(lintFinding{File: it.File, Line: line, Severity: severity, Rule: rule, Alias: it.Alias, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, a := range entryAliases(it.Alias) {
+		key := strings.ToUpper(a)
+		if prev, ok := l.aliases[key]; ok {
+			finding(it.Line, severityError, ruleDuplicate, "alias %s already defined in %s line %d", a, prev.File, prev.Line)
+		} else {
+			l.aliases[key] = lintFinding{File: it.File, Line: it.Line}
+		}
+	}
+	if it.Depth != 0 {
+		finding(it.Line, severityError, ruleSyntax, "unbalanced parentheses, %d not closed", it.Depth)
+		return
+	}
+	nodes, err := parseDescriptor(it.Desc, it.Line)
+	if err != nil {
+		finding(it.Line, severityError, ruleSyntax, "%v", err)
+		return
+	}
+	if len(findNodes(nodes, "SERVICE_NAME")) == 0 && len(findNodes(nodes, "SID")) == 0 {
+		finding(it.Line, severityError, ruleNoService, "no SERVICE_NAME or SID in CONNECT_DATA")
+	}
+	addresses := findNodes(nodes, "ADDRESS")
+	if len(addresses) == 0 {
+		finding(it.Line, severityError, ruleNoAddress, "no ADDRESS defined")
+	}
+	for _, a := range addresses {
+		l.lintAddress(a, finding)
+	}
+}
+
+// lintAddress checks HOST and PORT of an ADDRESS node
+func (l *tnsLinter) lintAddress(a *tnsNode, finding func(int, string, string, string, ...any)) {
+	protocol, _ := a.childValue("PROTOCOL")
+	if p := strings.ToUpper(protocol); p != "" && p != "TCP" && p != "TCPS" {
+		// IPC, BEQ and others have no host and port
+		return
+	}
+	host, hasHost := a.childValue("HOST")
+	port, hasPort := a.childValue("PORT")
+	switch {
+	case !hasHost || host == "":
+		finding(a.Line, severityError, ruleNoAddress, "ADDRESS without HOST")
+	case net.ParseIP(strings.Trim(host, "[]")) == nil && !hostnameRe.MatchString(host):
+		finding(a.Line, severityError, ruleInvalidHost, "invalid HOST '%s'", host)
+	case l.resolve && net.ParseIP(strings.Trim(host, "[]")) == nil:
+		if _, err := net.LookupHost(host); err != nil {
+			finding(a.Line, severityWarning, ruleResolveHost, "HOST %s cannot be resolved: %v", host, err)
+		}
+	}
+	if !hasPort {
+		finding(a.Line, severityError, ruleInvalidPort, "ADDRESS without PORT")
+		return
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		finding(a.Line, severityError, ruleInvalidPort, "PORT '%s' is not a number between 1 and 65535", port)
+	}
+}
+
+// counts returns the number of errors and warnings
+func (l *tnsLinter) counts() (errors int, warnings int) {
+	for _, f := range l.findings {
+		if f.Severity == severityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	return
+}
+
+// sort orders the findings by file and line
+func (l *tnsLinter) sort() {
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		if l.findings[i].File != l.findings[j].File {
+			return l.findings[i].File < l.findings[j].File
+		}
+		return l.findings[i].Line < l.findings[j].Line
+	})
+}
+
+// write prints the findings as text lines
+func (l *tnsLinter) write(w io.Writer) (err error) {
+	for _, f := range l.findings {
+		alias := ""
+		if f.Alias != "" {
+			alias = f.Alias + ": "
+		}
+		_, err = fmt.Fprintf(w, "%s:%d: %s [%s] %s%s\n", f.File, f.Line, f.Severity, f.Rule, alias, f.Message)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/tnscli/test"
+)
+
+const linttns = `# lint test
+ifile=missing.ora
+GOOD.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1.example.com)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=good)))
+NOSVC.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1.example.com)(PORT=1521))(CONNECT_DATA=(SERVER=DEDICATED)))
+BADPORT.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db_1.example..com)(PORT=15x1))(CONNECT_DATA=(SID=bad)))
+good.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db2.example.com)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=good)))
+OPEN.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1.example.com)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=open))
+LAST.local=
+  (DESCRIPTION=
+    (ADDRESS=(PROTOCOL=TCP)(HOST=10.0.0.1)(PORT=1521))
+    (CONNECT_DATA=(SERVICE_NAME=last))
+  )
+`
+
+func TestParseDescriptor(t *testing.T) {
+	items := scanTnsContent(tnsnamesora, tnsFile)
+	var entries []tnsItem
+	for _, it := range items {
+		if it.Kind == itemEntry {
+			entries = append(entries, it)
+		}
+	}
+	require.Equal(t, 2, len(entries), "2 entries expected")
+	t.Run("scan", func(t *testing.T) {
+		assert.Equal(t, "DB_T.local", entries[0].Alias, "alias not expected")
+		assert.Equal(t, 4, entries[0].Line, "line not expected")
+		assert.Equal(t, "DB_V.local", entries[1].Alias, "alias not expected")
+		assert.Equal(t, 0, entries[1].Depth, "entry should be balanced")
+	})
+	t.Run("tree", func(t *testing.T) {
+		nodes, err := parseDescriptor(entries[0].Desc, entries[0].Line)
+		require.NoErrorf(t, err, "parse failed: %s", err)
+		require.Equal(t, 1, len(nodes), "one DESCRIPTION expected")
+		addresses := findNodes(nodes, "ADDRESS")
+		require.Equal(t, 2, len(addresses), "2 addresses expected")
+		host, _ := addresses[1].childValue("host")
+		assert.Equal(t, "tdb2.ora.local", host, "host not expected")
+		assert.Equal(t, 16, addresses[1].Line, "line of 2nd address not expected")
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, err := parseDescriptor("(DESCRIPTION=((CONNECT_TIMEOUT=3))", 1)
+		assert.Error(t, err, "missing keyword should fail")
+		_, err = parseDescriptor("(DESCRIPTION=(ADDRESS=(HOST=x)\n(PORT=1)", 5)
+		require.Error(t, err, "missing parenthesis should fail")
+		assert.Contains(t, err.Error(), "line 6", "line number not expected")
+	})
+}
+
+func TestLint(t *testing.T) {
+	test.InitTestDirs()
+	err := os.Chdir(test.TestDir)
+	require.NoErrorf(t, err, "ChDir failed")
+	lintFile := path.Join(tnsAdminDir, "lint.ora")
+	err = common.WriteStringToFile(lintFile, linttns)
+	require.NoErrorf(t, err, "Create test %s failed", lintFile)
+
+	l := newTnsLinter(false)
+	l.lintFile(lintFile)
+	l.sort()
+	rules := map[string]int{}
+	for _, f := range l.findings {
+		t.Logf("%v", f)
+		rules[f.Rule] = f.Line
+	}
+	t.Run("findings", func(t *testing.T) {
+		assert.Equal(t, 2, rules[ruleIfile], "missing ifile not reported")
+		assert.Equal(t, 4, rules[ruleNoService], "missing service not reported")
+		assert.Equal(t, 5, rules[ruleInvalidHost], "invalid host not reported")
+		assert.Equal(t, 5, rules[ruleInvalidPort], "invalid port not reported")
+		assert.Equal(t, 6, rules[ruleDuplicate], "duplicate not reported")
+		assert.Equal(t, 7, rules[ruleSyntax], "unbalanced entry not reported")
+		assert.NotContains(t, rules, ruleLoad, "load error reported beside specific findings")
+		for _, f := range l.findings {
+			assert.NotEqual(t, "LAST.local", f.Alias, "valid entry reported")
+		}
+	})
+	t.Run("text output", func(t *testing.T) {
+		var sb strings.Builder
+		err = l.write(&sb)
+		require.NoErrorf(t, err, "write failed: %s", err)
+		assert.Contains(t, sb.String(), lintFile+":6: error [TNS004] good.local: alias good.local already defined")
+	})
+	t.Run("load error beside ifile error", func(t *testing.T) {
+		parent := path.Join(tnsAdminDir, "lintparent.ora")
+		child := path.Join(tnsAdminDir, "lintchild.ora")
+		err = common.WriteStringToFile(parent, "ifile=lintchild.ora\nPARENT.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1.example.com)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=parent)))\n")
+		require.NoErrorf(t, err, "Create test %s failed", parent)
+		err = common.WriteStringToFile(child, "CHILD.local=(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db1.example.com)(PORT=1521))\n")
+		require.NoErrorf(t, err, "Create test %s failed", child)
+		pl := newTnsLinter(false)
+		pl.load = func(file string) error {
+			if file == parent {
+				return fmt.Errorf("parse error")
+			}
+			return nil
+		}
+		pl.lintFile(parent)
+		found := map[string]string{}
+		for _, f := range pl.findings {
+			t.Logf("%v", f)
+			found[f.Rule] = f.File
+		}
+		assert.Equal(t, child, found[ruleSyntax], "ifile error not reported")
+		assert.Equal(t, parent, found[ruleLoad], "load error of parent hidden by ifile error")
+	})
+	t.Run("CMD lint", func(t *testing.T) {
+		args := []string{
+			"lint",
+			lintFile,
+			flagInfo,
+			flagUnitTest,
+		}
+		out, cmdErr := common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.Error(t, cmdErr, "lint should fail")
+	})
+}
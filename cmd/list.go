@@ -3,10 +3,10 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"sort"
-	"strings"
 
 	"github.com/tommi2day/gomodules/dblib"
 
@@ -49,7 +49,7 @@ func listTns(_ *cobra.Command, _ []string) error {
 	return err
 }
 
-func outputTNS(tnsEntries dblib.TNSEntries, fo *os.File, full bool) (err error) {
+func outputTNS(tnsEntries dblib.TNSEntries, fo io.Writer, full bool) (err error) {
 	l := len(tnsEntries)
 	if search == "" {
 		log.Debugf("list %d entries", l)
@@ -96,14 +96,7 @@ func outputTNS(tnsEntries dblib.TNSEntries, fo *os.File, full bool) (err error)
 func formatEntry(entries dblib.TNSEntries, key string, full bool) (out string) {
 	if full {
 		entry := entries[key]
-		desc := entry.Desc
-		loc := entry.Location
-		tnsAlias := entry.Name
-		desc = strings.ReplaceAll(desc, "\r", " ")
-		desc = strings.ReplaceAll(desc, "\n", "\n  ")
-		desc = strings.ReplaceAll(desc, "(ADDRESS_LIST", "  (ADDRESS_LIST")
-		desc = strings.ReplaceAll(desc, "(CONNECT_DATA", "  (CONNECT_DATA")
-		out = fmt.Sprintf("# Location: %s \n%s=  %s", loc, tnsAlias, desc)
+		out = fmt.Sprintf("# Location: %s\n%s =\n%s", entry.Location, entry.Name, formatDescriptor(entry.Desc, "  "))
 	} else {
 		out = fmt.Sprintf("%s\n", key)
 	}
@@ -0,0 +1,53 @@
+// Package cmd commands
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputCSV  = "csv"
+)
+
+// checkOutputFormat verifies the given format is one of the allowed values
+func checkOutputFormat(format string, allowed ...string) (f string, err error) {
+	f = strings.ToLower(format)
+	if f == "" {
+		f = outputText
+	}
+	for _, a := range allowed {
+		if f == a {
+			return
+		}
+	}
+	err = fmt.Errorf("invalid output format '%s', use one of %s", format, strings.Join(allowed, ","))
+	return
+}
+
+// writeStructured writes v as json or yaml document to w
+func writeStructured(w io.Writer, format string, v any) (err error) {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		err = enc.Encode(v)
+		if err == nil {
+			err = enc.Close()
+		}
+	default:
+		err = fmt.Errorf("format %s not supported for structured output", format)
+	}
+	return
+}
@@ -0,0 +1,416 @@
+// Package cmd commands
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "run as daemon and export check results",
+		Long: `re-check TNS entries on a schedule and expose the results as Prometheus metrics on /metrics.
+tnsnames.ora is reloaded when it or one of its ifiles changes`,
+		RunE:         serve,
+		SilenceUsage: true,
+	}
+)
+
+var serveMetrics = false
+var serveListen = ":9610"
+var serveInterval = time.Minute
+var serveSearch []string
+
+// connect latency buckets in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// aliasMetrics holds the last state of one alias
+type aliasMetrics struct {
+	location string
+	up       bool
+	oraCode  int
+	buckets  []uint64
+	sum      float64
+	count    uint64
+	ports    map[string]bool
+}
+
+// serveResult is the check result and the port states of one alias
+type serveResult struct {
+	check checkResult
+	ports map[string]bool
+}
+
+// tnsExporter checks the selected aliases and renders the metrics
+type tnsExporter struct {
+	mu           sync.RWMutex
+	filename     string
+	patterns     []*regexp.Regexp
+	entries      dblib.TNSEntries
+	mtimes       map[string]time.Time
+	aliases      map[string]*aliasMetrics
+	reloads      int
+	lastRun      time.Time
+	lastDuration time.Duration
+}
+
+func init() {
+	serveCmd.Flags().BoolVar(&serveMetrics, "metrics", false, "expose Prometheus metrics on /metrics")
+	serveCmd.Flags().StringVarP(&serveListen, "listen", "l", serveListen, "address to listen for http requests")
+	serveCmd.Flags().DurationVarP(&serveInterval, "interval", "i", serveInterval, "interval between check runs")
+	serveCmd.Flags().StringSliceVarP(&serveSearch, "search", "s", nil, "regex to select aliases, may be repeated, default all")
+	serveCmd.Flags().StringVarP(&dbUser, "user", "u", dbUser, "User for real connect or set TNSCLI_USER")
+	serveCmd.Flags().StringVarP(&dbPass, "password", "p", dbPass, "Password for real connect or set TNSCLI_PASSWORD")
+	serveCmd.Flags().IntVarP(&timeout, "timeout", "t", timeout, "timeout in sec")
+	serveCmd.Flags().StringVarP(&walletPassword, "wallet-password", "", walletPassword,
+		"Password for a PKCS12 wallet (ewallet.p12) or set TNSCLI_WALLET_PASSWORD; not needed for auto-login wallets")
+	serveCmd.Flags().IntVarP(&parallel, "parallel", "P", parallel, "number of concurrent checks")
+	RootCmd.AddCommand(serveCmd)
+}
+
+func serve(_ *cobra.Command, _ []string) (err error) {
+	if !serveMetrics {
+		err = fmt.Errorf("nothing to serve, use --metrics to enable the metrics endpoint")
+		return
+	}
+	if serveInterval < time.Second {
+		err = fmt.Errorf("interval %s too short", serveInterval)
+		return
+	}
+	if dbUser == "" {
+		dbUser = common.GetEnv("TNSCLI_USER", "")
+	}
+	if dbPass == "" {
+		dbPass = common.GetEnv("TNSCLI_PASSWORD", "")
+	}
+	if walletPassword == "" {
+		walletPassword = common.GetEnv("TNSCLI_WALLET_PASSWORD", "")
+	}
+	dblib.TNSSSLconfig.WalletPassword = walletPassword
+	if err = loadHealthQueries(); err != nil {
+		return
+	}
+	e, err := newTnsExporter(filename, serveSearch)
+	if err != nil {
+		return
+	}
+	if _, err = e.reload(); err != nil {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if werr := e.writeMetrics(w); werr != nil {
+			log.Warnf("write metrics failed: %v", werr)
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s\nmetrics: /metrics\n", GetVersion(false))
+	})
+	srv := &http.Server{
+		Addr:              serveListen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go e.run(ctx, serveInterval)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	log.Infof("serve metrics on %s/metrics, check interval %s", serveListen, serveInterval)
+	err = srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		log.Info("server stopped")
+		err = nil
+	}
+	return
+}
+
+// newTnsExporter creates an exporter for the given file and alias regexes
+func newTnsExporter(file string, search []string) (e *tnsExporter, err error) {
+	e = &tnsExporter{
+		filename: file,
+		mtimes:   map[string]time.Time{},
+		aliases:  map[string]*aliasMetrics{},
+	}
+	for _, s := range search {
+		var re *regexp.Regexp
+		re, err = regexp.Compile("(?i)" + s)
+		if err != nil {
+			err = fmt.Errorf("invalid search regex '%s': %v", s, err)
+			return
+		}
+		e.patterns = append(e.patterns, re)
+	}
+	return
+}
+
+// run checks the aliases at every interval until ctx is canceled
+func (e *tnsExporter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if changed, err := e.reload(); err != nil {
+			log.Warnf("reload %s failed, keep previous entries: %v", e.filename, err)
+		} else if changed {
+			log.Infof("loaded %d entries from %s", len(e.entries), e.filename)
+		}
+		e.checkAll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reload reads tnsnames.ora again if it or one of its ifiles changed
+func (e *tnsExporter) reload() (changed bool, err error) {
+	if e.entries != nil && !e.filesChanged() {
+		return
+	}
+	entries, _, err := dblib.GetTnsnames(e.filename, true)
+	if err != nil {
+		return
+	}
+	if len(entries) == 0 {
+		err = fmt.Errorf("no entries found in %s", e.filename)
+		return
+	}
+	mtimes := map[string]time.Time{}
+	for _, f := range tnsFiles(e.filename, entries) {
+		if fi, serr := os.Stat(f); serr == nil {
+			mtimes[f] = fi.ModTime()
+		}
+	}
+	e.mu.Lock()
+	e.entries = entries
+	e.mtimes = mtimes
+	e.reloads++
+	// forget aliases which are not longer present
+	for a := range e.aliases {
+		if _, ok := entries[a]; !ok {
+			delete(e.aliases, a)
+		}
+	}
+	e.mu.Unlock()
+	changed = true
+	return
+}
+
+// filesChanged reports if one of the loaded files has a new modification time
+func (e *tnsExporter) filesChanged() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for f, t := range e.mtimes {
+		fi, err := os.Stat(f)
+		if err != nil || !fi.ModTime().Equal(t) {
+			log.Debugf("%s changed", f)
+			return true
+		}
+	}
+	return false
+}
+
+// selected returns the sorted aliases matching the search patterns
+func (e *tnsExporter) selected() (keys []string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for k := range e.entries {
+		if len(e.patterns) == 0 {
+			keys = append(keys, k)
+			continue
+		}
+		for _, re := range e.patterns {
+			if re.MatchString(k) {
+				keys = append(keys, k)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+// checkAll runs one check cycle for all selected aliases
+func (e *tnsExporter) checkAll() {
+	start := time.Now()
+	keys := e.selected()
+	e.mu.RLock()
+	entries := e.entries
+	e.mu.RUnlock()
+	log.Debugf("check %d aliases", len(keys))
+	// the ports are probed by the worker of the alias to keep them parallel
+	results := runWorkers(keys, parallel, func(k string) serveResult {
+		return serveResult{check: checkAlias(entries[k]), ports: pingPorts(entries[k])}
+	})
+	for i, k := range keys {
+		r := <-results[i]
+		e.record(k, r.check, r.ports)
+	}
+	e.mu.Lock()
+	e.lastRun = start
+	e.lastDuration = time.Since(start)
+	e.mu.Unlock()
+	log.Infof("checked %d aliases in %s", len(keys), time.Since(start).Round(time.Millisecond))
+}
+
+// pingPorts probes the tcp port of every address of the entry
+func pingPorts(entry dblib.TNSEntry) (ports map[string]bool) {
+	ports = map[string]bool{}
+	for _, s := range entry.Servers {
+		address := net.JoinHostPort(s.Host, s.Port)
+		state, _ := pingPort(address)
+		ports[address] = state == portOpen
+	}
+	return
+}
+
+// record stores the result of one alias check
+func (e *tnsExporter) record(alias string, r checkResult, ports map[string]bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.aliases[alias]
+	if !ok {
+		m = &aliasMetrics{buckets: make([]uint64, len(latencyBuckets))}
+		e.aliases[alias] = m
+	}
+	m.location = r.Location
+	m.up = r.OK
+	m.oraCode = r.OraCode
+	m.ports = ports
+	seconds := float64(r.ElapsedMS) / 1000
+	for i, b := range latencyBuckets {
+		if seconds <= b {
+			m.buckets[i]++
+		}
+	}
+	m.sum += seconds
+	m.count++
+}
+
+// writeMetrics renders all metrics in Prometheus text exposition format
+func (e *tnsExporter) writeMetrics(w io.Writer) (err error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	keys := make([]string, 0, len(e.aliases))
+	for k := range e.aliases {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	metricHeader(&sb, "tnscli_service_up", "gauge", "1 if the last connect check of the alias succeeded")
+	for _, k := range keys {
+		m := e.aliases[k]
+		fmt.Fprintf(&sb, "tnscli_service_up{alias=\"%s\",location=\"%s\"} %d\n", labelValue(k), labelValue(m.location), boolValue(m.up))
+	}
+	metricHeader(&sb, "tnscli_service_connect_seconds", "histogram", "connect latency of the alias checks")
+	for _, k := range keys {
+		m := e.aliases[k]
+		a := labelValue(k)
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(&sb, "tnscli_service_connect_seconds_bucket{alias=\"%s\",le=\"%g\"} %d\n", a, b, m.buckets[i])
+		}
+		fmt.Fprintf(&sb, "tnscli_service_connect_seconds_bucket{alias=\"%s\",le=\"+Inf\"} %d\n", a, m.count)
+		fmt.Fprintf(&sb, "tnscli_service_connect_seconds_sum{alias=\"%s\"} %g\n", a, m.sum)
+		fmt.Fprintf(&sb, "tnscli_service_connect_seconds_count{alias=\"%s\"} %d\n", a, m.count)
+	}
+	metricHeader(&sb, "tnscli_service_last_ora_error", "gauge", "ORA error code of the last check, 0 if none")
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "tnscli_service_last_ora_error{alias=\"%s\"} %d\n", labelValue(k), e.aliases[k].oraCode)
+	}
+	metricHeader(&sb, "tnscli_service_port_up", "gauge", "1 if the tcp port of the address is open")
+	for _, k := range keys {
+		m := e.aliases[k]
+		addresses := make([]string, 0, len(m.ports))
+		for a := range m.ports {
+			addresses = append(addresses, a)
+		}
+		sort.Strings(addresses)
+		for _, a := range addresses {
+			fmt.Fprintf(&sb, "tnscli_service_port_up{alias=\"%s\",address=\"%s\"} %d\n", labelValue(k), labelValue(a), boolValue(m.ports[a]))
+		}
+	}
+	metricHeader(&sb, "tnscli_aliases", "gauge", "number of aliases selected for checks")
+	fmt.Fprintf(&sb, "tnscli_aliases %d\n", len(keys))
+	metricHeader(&sb, "tnscli_tnsnames_reloads_total", "counter", "number of times tnsnames.ora has been loaded")
+	fmt.Fprintf(&sb, "tnscli_tnsnames_reloads_total %d\n", e.reloads)
+	if !e.lastRun.IsZero() {
+		metricHeader(&sb, "tnscli_check_run_timestamp_seconds", "gauge", "start time of the last check run")
+		fmt.Fprintf(&sb, "tnscli_check_run_timestamp_seconds %d\n", e.lastRun.Unix())
+		metricHeader(&sb, "tnscli_check_run_duration_seconds", "gauge", "duration of the last check run")
+		fmt.Fprintf(&sb, "tnscli_check_run_duration_seconds %g\n", e.lastDuration.Seconds())
+	}
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+func metricHeader(sb *strings.Builder, name string, kind string, help string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelValue escapes a Prometheus label value
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// tnsFiles returns the main file and all ifiles the entries were loaded from
+func tnsFiles(file string, entries dblib.TNSEntries) (files []string) {
+	seen := map[string]bool{file: true}
+	files = append(files, file)
+	dir := filepath.Dir(file)
+	for _, e := range entries {
+		f := entryFile(e.Location, dir)
+		if f != "" && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files[1:])
+	return
+}
+
+// entryFile extracts the file name from an entry location "file Line: n"
+func entryFile(location string, dir string) (f string) {
+	f, _, _ = strings.Cut(location, " Line:")
+	f = strings.TrimSpace(f)
+	if f == "" || filepath.IsAbs(f) {
+		return
+	}
+	// ifiles are reported relative to the directory of the including file
+	if _, err := os.Stat(f); err != nil {
+		f = filepath.Join(dir, f)
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestServeMetrics(t *testing.T) {
+	e, err := newTnsExporter("tnsnames.ora", []string{"^XE", "free"})
+	require.NoErrorf(t, err, "create exporter failed: %s", err)
+	e.entries = dblib.TNSEntries{
+		"XE.local":   {Name: "XE.local"},
+		"FREE.local": {Name: "FREE.local"},
+		"DB_T.local": {Name: "DB_T.local"},
+	}
+
+	t.Run("invalid search", func(t *testing.T) {
+		_, err = newTnsExporter("tnsnames.ora", []string{"("})
+		assert.Error(t, err, "invalid regex should fail")
+	})
+	t.Run("select aliases", func(t *testing.T) {
+		actual := e.selected()
+		assert.Equal(t, []string{"FREE.local", "XE.local"}, actual, "selection not expected")
+	})
+	t.Run("exposition", func(t *testing.T) {
+		e.record("XE.local", checkResult{Name: "XE.local", Location: "ifile.ora Line: 6", OK: true, ElapsedMS: 40, OraCode: 1017},
+			map[string]bool{"127.0.0.1:1521": true})
+		e.record("FREE.local", checkResult{Name: "FREE.local", Location: "connect.ora Line: 1", OK: false, ElapsedMS: 3000, OraCode: 12514},
+			map[string]bool{"127.0.0.1:1522": false})
+		var sb strings.Builder
+		err = e.writeMetrics(&sb)
+		require.NoErrorf(t, err, "write metrics failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "# TYPE tnscli_service_up gauge")
+		assert.Contains(t, out, `tnscli_service_up{alias="XE.local",location="ifile.ora Line: 6"} 1`)
+		assert.Contains(t, out, `tnscli_service_up{alias="FREE.local",location="connect.ora Line: 1"} 0`)
+		assert.Contains(t, out, `tnscli_service_connect_seconds_bucket{alias="XE.local",le="0.05"} 1`)
+		assert.Contains(t, out, `tnscli_service_connect_seconds_bucket{alias="FREE.local",le="2.5"} 0`)
+		assert.Contains(t, out, `tnscli_service_connect_seconds_count{alias="FREE.local"} 1`)
+		assert.Contains(t, out, `tnscli_service_last_ora_error{alias="FREE.local"} 12514`)
+		assert.Contains(t, out, `tnscli_service_port_up{alias="XE.local",address="127.0.0.1:1521"} 1`)
+	})
+	t.Run("ping ports", func(t *testing.T) {
+		l, lerr := net.Listen("tcp", "127.0.0.1:0")
+		require.NoErrorf(t, lerr, "listen failed: %s", lerr)
+		defer func() { _ = l.Close() }()
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		ports := pingPorts(dblib.TNSEntry{Servers: []dblib.TNSAddress{{Host: host, Port: port}}})
+		assert.Equal(t, map[string]bool{l.Addr().String(): true}, ports, "open port not detected")
+	})
+	t.Run("workers keep key order", func(t *testing.T) {
+		keys := []string{"a", "b", "c", "d"}
+		results := runWorkers(keys, 3, strings.ToUpper)
+		for i, k := range keys {
+			assert.Equal(t, strings.ToUpper(k), <-results[i], "result order mismatch")
+		}
+	})
+	t.Run("label escaping", func(t *testing.T) {
+		assert.Equal(t, `a\"b\\c\n`, labelValue("a\"b\\c\n"))
+	})
+	t.Run("entry file", func(t *testing.T) {
+		assert.Equal(t, filepath.Join("/etc/oracle", "ifile.ora"), entryFile("ifile.ora Line: 6", "/etc/oracle"))
+		assert.Equal(t, "/tmp/tnsnames.ora", entryFile("/tmp/tnsnames.ora Line: 2", "/etc/oracle"))
+		assert.Empty(t, entryFile("", "/etc/oracle"))
+	})
+}
@@ -2,8 +2,12 @@
 package cmd
 
 import (
+	"database/sql"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"path"
 	"regexp"
 	"sort"
@@ -87,6 +91,9 @@ const defaultUser = "C##TCHECK"
 const defaultPassword = "Test2Devk#25"
 const racinfoFile = "racinfo.ini"
 
+// dbhostSQL extracts host, cdb and pdb of the session
+const dbhostSQL = "select sys_context('USERENV','SERVER_HOST')||':'||sys_context('USERENV','INSTANCE_NAME')||':'||nvl(sys_context('USERENV','CON_NAME'),'') as dbhostFlag from dual"
+
 var dbUser = ""
 var dbPass = ""
 var walletPassword = ""
@@ -102,6 +109,40 @@ var pingTimeout = 5
 var tcpcheck = false
 var dnstcp = false
 var noModifyTransportConnectTimeout = false
+var checkOutput = outputText
+var parallel = 1
+
+// checkResult holds the outcome of a single alias check for structured output
+type checkResult struct {
+	Name      string `json:"name" yaml:"name"`
+	Location  string `json:"location" yaml:"location"`
+	Address   string `json:"address,omitempty" yaml:"address,omitempty"`
+	OK        bool   `json:"ok" yaml:"ok"`
+	ElapsedMS int64  `json:"elapsed_ms" yaml:"elapsed_ms"`
+	DBHost    string `json:"dbhost,omitempty" yaml:"dbhost,omitempty"`
+	Result    string `json:"result,omitempty" yaml:"result,omitempty"`
+	OraCode   int    `json:"ora_code,omitempty" yaml:"ora_code,omitempty"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Timing holds the connect phases with --timing
+	Timing *connectTiming `json:"timing,omitempty" yaml:"timing,omitempty"`
+	// DataGuard holds role and lags with --dataguard
+	DataGuard *dgStatus `json:"dataguard,omitempty" yaml:"dataguard,omitempty"`
+}
+
+// checkSummary counts the results of a check run
+type checkSummary struct {
+	Checked int `json:"checked" yaml:"checked"`
+	OK      int `json:"ok" yaml:"ok"`
+	Failed  int `json:"failed" yaml:"failed"`
+}
+
+// checkReport is the structured output of service check --all
+type checkReport struct {
+	Results []checkResult `json:"results" yaml:"results"`
+	Summary checkSummary  `json:"summary" yaml:"summary"`
+	// Warnings are the data guard warnings with --dataguard
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
 
 func init() {
 	serviceCmd.PersistentFlags().StringVarP(&tnsKey, "service", "s", "", "service name to check")
@@ -114,6 +155,8 @@ func init() {
 	checkCmd.PersistentFlags().BoolVarP(&all, "all", "a", false, "check all entries")
 	checkCmd.PersistentFlags().IntVarP(&timeout, "timeout", "t", timeout, "timeout in sec")
 	checkCmd.Flags().BoolVarP(&dbhostFlag, "dbhost", "H", false, "print actual connected host:cdb:pdb")
+	checkCmd.Flags().StringVarP(&checkOutput, "output", "o", checkOutput, "output format for --all: text, json, yaml or csv")
+	checkCmd.Flags().IntVarP(&parallel, "parallel", "P", parallel, "number of concurrent checks for --all and --each-address")
 
 	portInfoCmd.Flags().StringVarP(&racinfo, "racinfo", "r", "", "path to racinfo.ini to resolve all RAC TCP Adresses, default $TNS_ADMIN/racinfo.ini")
 	portInfoCmd.Flags().StringVarP(&nameserver, "nameserver", "n", "", "alternative nameserver to use for DNS lookup (IP:PORT)")
@@ -226,35 +269,57 @@ func doPortcheck(c *cobra.Command, args []string) (err error) {
 	return
 }
 
-func doTCPPing(host string, address string) {
+const (
+	portOpen    = "OPEN"
+	portClosed  = "CLOSED"
+	portTimeout = "TIMEOUT"
+	portProblem = "PROBLEM"
+)
+
+// pingPort tries a tcp connect to address and classifies the result
+func pingPort(address string) (state string, err error) {
 	d := net.Dialer{Timeout: time.Duration(pingTimeout) * time.Second}
-	_, err := d.Dial("tcp", address)
-	if err != nil {
-		match, _ := regexp.MatchString("refused", err.Error())
-		if match {
-			// Closed
-			log.Infof("%s, %s is CLOSED/REFUSED (no service)", host, address)
-			fmt.Printf("%s (%s) is CLOSED/REFUSED (no service)\n", host, address)
-			return
-		}
-		match, _ = regexp.MatchString("timeout", err.Error())
-		if match {
-			// Timeout
-			log.Infof("%s (%s) TIMEOUT (blocked)", host, address)
-			fmt.Printf("%s (%s) TIMEOUT (blocked)\n", host, address)
-			return
-		}
-	} else {
+	c, err := d.Dial("tcp", address)
+	if err == nil {
+		_ = c.Close()
+		state = portOpen
+		return
+	}
+	match, _ := regexp.MatchString("refused", err.Error())
+	if match {
+		state = portClosed
+		return
+	}
+	match, _ = regexp.MatchString("timeout", err.Error())
+	if match {
+		state = portTimeout
+		return
+	}
+	state = portProblem
+	return
+}
+
+func doTCPPing(host string, address string) {
+	state, err := pingPort(address)
+	switch state {
+	case portClosed:
+		// Closed
+		log.Infof("%s, %s is CLOSED/REFUSED (no service)", host, address)
+		fmt.Printf("%s (%s) is CLOSED/REFUSED (no service)\n", host, address)
+	case portTimeout:
+		// Timeout
+		log.Infof("%s (%s) TIMEOUT (blocked)", host, address)
+		fmt.Printf("%s (%s) TIMEOUT (blocked)\n", host, address)
+	case portOpen:
 		// Open
 		log.Infof("%s(%s) is OPEN", host, address)
 		fmt.Printf("%s (%s) is OPEN\n", host, address)
-		return
+	default:
+		e := err.Error()
+		e = strings.ReplaceAll(e, "dial tcp:", "")
+		log.Infof("%s(%s) port status PROBLEM: %s ", host, address, e)
+		fmt.Printf("%s (%s) port status PROBLEM: %s\n", host, address, e)
 	}
-	// Default
-	e := err.Error()
-	e = strings.ReplaceAll(e, "dial tcp:", "")
-	log.Infof("%s(%s) port status PROBLEM: %s ", host, address, e)
-	fmt.Printf("%s (%s) port status PROBLEM: %s\n", host, address, e)
 }
 
 func getTnsInfo(_ *cobra.Command, args []string) (err error) {
@@ -267,14 +332,7 @@ func getTnsInfo(_ *cobra.Command, args []string) (err error) {
 	}
 	entry, err := getEntry(tnsKey)
 	if err == nil {
-		desc := entry.Desc
-		tnsAlias := entry.Name
-		loc := entry.Location
-		desc = strings.ReplaceAll(desc, "\r", " ")
-		desc = strings.ReplaceAll(desc, "\n", "\n  ")
-		desc = strings.ReplaceAll(desc, "(ADDRESS_LIST", "  (ADDRESS_LIST")
-		desc = strings.ReplaceAll(desc, "(CONNECT_DATA", "  (CONNECT_DATA")
-		out := fmt.Sprintf("# Location: %s \n%s=  %s", loc, tnsAlias, desc)
+		out := fmt.Sprintf("# Location: %s\n%s =\n%s", entry.Location, entry.Name, formatDescriptor(entry.Desc, "  "))
 		log.Info(out)
 		fmt.Println(out)
 	}
@@ -308,6 +366,13 @@ func getJdbcInfo(_ *cobra.Command, args []string) (err error) {
 }
 
 func checkTns(_ *cobra.Command, args []string) (err error) {
+	// structured output is only written for --all
+	if !all {
+		if _, e := checkOutputFormat(checkOutput, outputText); e != nil {
+			err = fmt.Errorf("--output %s needs --all", checkOutput)
+			return
+		}
+	}
 	// load available tns entries
 	tnsEntries, domain, err := dblib.GetTnsnames(filename, true)
 	l := len(tnsEntries)
@@ -332,6 +397,25 @@ func checkTns(_ *cobra.Command, args []string) (err error) {
 		walletPassword = common.GetEnv("TNSCLI_WALLET_PASSWORD", "")
 	}
 	dblib.TNSSSLconfig.WalletPassword = walletPassword
+	if err = loadHealthQueries(); err != nil {
+		return
+	}
+	if timingFlag {
+		// phases are measured per address
+		eachAddress = true
+	}
+	if dataguardFlag {
+		if dbUser == "" || dbPass == "" {
+			err = fmt.Errorf("--dataguard needs a real login, use --user and --password or set TNSCLI_USER and TNSCLI_PASSWORD")
+			return
+		}
+		// the role is queried per address
+		eachAddress = true
+	}
+	if eachAddress {
+		// the node reached is the point of checking each address
+		dbhostFlag = true
+	}
 
 	// do checks depending on mode
 	if all {
@@ -344,6 +428,10 @@ func checkTns(_ *cobra.Command, args []string) (err error) {
 
 func allCheck(tnsEntries dblib.TNSEntries) (err error) {
 	var failed []string
+	format, err := checkOutputFormat(checkOutput, outputText, outputJSON, outputYAML, outputCSV)
+	if err != nil {
+		return
+	}
 	l := len(tnsEntries)
 	log.Debugf("check all %d entries", l)
 	keys := make([]string, 0, l)
@@ -351,40 +439,255 @@ func allCheck(tnsEntries dblib.TNSEntries) (err error) {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-	o := 0
-	e := 0
-	i := 0
-	for _, k := range keys {
-		entry := tnsEntries[k]
-		desc := entry.Desc
-		tnsAlias := entry.Name
-		fmt.Printf("%s: ", tnsAlias)
-		ok, elapsed, hostval, errmsg := CheckWithOracle(dbUser, dbPass, desc, timeout)
-		if ok {
-			o++
-			if dbhostFlag {
-				fmt.Printf(" OK-> %s, %s\n", hostval, elapsed.Round(time.Millisecond))
-			} else {
-				fmt.Printf(" OK-> %s\n", elapsed.Round(time.Millisecond))
-			}
+	var addresses map[string]string
+	// the descriptors lose LOAD_BALANCE when split into addresses
+	balanced := loadBalanced(tnsEntries)
+	if eachAddress {
+		tnsEntries, keys, addresses = expandAddresses(tnsEntries, keys, addressResolver())
+	}
+	report := checkReport{Results: make([]checkResult, 0, len(keys))}
+	results := runChecks(tnsEntries, keys, parallel)
+	for i := range keys {
+		// wait for results in sorted order, checks may finish in any order
+		r := <-results[i]
+		r.Address = addresses[keys[i]]
+		tnsAlias := checkLabel(r)
+		if format == outputText {
+			fmt.Printf("%s: ", tnsAlias)
+		}
+		report.Results = append(report.Results, r)
+		report.Summary.Checked++
+		if r.OK {
+			report.Summary.OK++
 		} else {
-			e++
-			fmt.Printf(" ERROR: %s\n", errmsg)
-			failed = append(failed, fmt.Sprintf("%s: %v", tnsAlias, errmsg))
+			report.Summary.Failed++
+			failed = append(failed, fmt.Sprintf("%s: %v", tnsAlias, r.Error))
+		}
+		if format == outputText {
+			printCheckResult(r)
+		}
+	}
+	if format == outputText && withTiming(report.Results) {
+		if err = writeTimingTable(os.Stdout, report.Results); err != nil {
+			return
+		}
+	}
+	if dataguardFlag {
+		if report.Warnings, err = checkDataGuard(report.Results, balanced); err != nil {
+			return
+		}
+		if format == outputText {
+			printDataGuardWarnings(report.Warnings)
 		}
-		i++
 	}
 	log.Info("Checks finished ...")
-	log.Infof(" %d entries checked, %d ok, %d failed\n", i, o, e)
+	log.Infof(" %d entries checked, %d ok, %d failed\n", report.Summary.Checked, report.Summary.OK, report.Summary.Failed)
+	if format != outputText {
+		err = writeCheckReport(os.Stdout, format, report)
+		if err != nil {
+			return
+		}
+	}
 	if len(failed) > 0 {
-		for _, s := range failed {
-			fmt.Println(s)
+		if format == outputText {
+			for _, s := range failed {
+				fmt.Println(s)
+			}
 		}
 		err = fmt.Errorf("some checks failed")
 	}
 	return
 }
 
+// runChecks checks the given keys using a pool of n workers. It returns one
+// result channel per key to allow the caller to consume them in key order
+func runChecks(tnsEntries dblib.TNSEntries, keys []string, n int) []chan checkResult {
+	return runWorkers(keys, n, func(k string) checkResult {
+		return checkAlias(tnsEntries[k])
+	})
+}
+
+// runWorkers calls work for the given keys using a pool of n workers and
+// returns one result channel per key
+func runWorkers[T any](keys []string, n int, work func(string) T) []chan T {
+	if n < 1 {
+		n = 1
+	}
+	log.Debugf("run checks with %d workers", n)
+	results := make([]chan T, len(keys))
+	for i := range results {
+		results[i] = make(chan T, 1)
+	}
+	jobs := make(chan int)
+	for w := 0; w < n; w++ {
+		go func() {
+			for i := range jobs {
+				results[i] <- work(keys[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range keys {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+	return results
+}
+
+// checkAlias runs the check query for one entry and collects the result
+func checkAlias(entry dblib.TNSEntry) (r checkResult) {
+	q := healthQueryFor(entry.Name)
+	// node and role are read on the connection of the check, no second login
+	var inspect []func(db *sql.DB)
+	if q.SQL != "" && dbhostFlag {
+		// the health query replaces the host query, the node is still reported
+		inspect = append(inspect, func(db *sql.DB) {
+			r.DBHost = queryDBHost(sqlQuerier(db))
+		})
+	}
+	if dataguardFlag {
+		inspect = append(inspect, func(db *sql.DB) {
+			r.DataGuard = collectDataGuard(sqlQuerier(db))
+		})
+	}
+	if len(inspect) > 0 {
+		q.inspect = func(db *sql.DB) {
+			for _, f := range inspect {
+				f(db)
+			}
+		}
+	}
+	r.Name = entry.Name
+	r.Location = entry.Location
+	if timingFlag {
+		r.Timing = measureTiming(entry.Desc, time.Duration(timeout)*time.Second)
+	}
+	ok, elapsed, hostval, errmsg := checkWithQuery(dbUser, dbPass, entry.Desc, timeout, q)
+	r.OK = ok
+	r.ElapsedMS = elapsed.Milliseconds()
+	if r.Timing != nil {
+		r.Timing.setLogin(elapsed)
+	}
+	switch {
+	case q.SQL != "":
+		r.Result = hostval
+	case ok && dbhostFlag:
+		r.DBHost = hostval
+	}
+	if errmsg != nil {
+		r.Error = errmsg.Error()
+		if isOerr, code, _ := dblib.HaveOerr(errmsg); isOerr {
+			r.OraCode = code
+		}
+	}
+	return
+}
+
+// queryDBHost returns host:cdb:pdb of the session, empty if the query fails
+func queryDBHost(query dbQuerier) string {
+	rows, err := query(dbhostSQL)
+	if err != nil || len(rows) == 0 || len(rows[0]) == 0 {
+		log.Warnf("cannot query db host: %v", err)
+		return ""
+	}
+	return rows[0][0]
+}
+
+// printCheckResult prints the text result line of an alias check
+func printCheckResult(r checkResult) {
+	fmt.Print(checkResultText(r))
+}
+
+// checkResultText returns the text result line of an alias check
+func checkResultText(r checkResult) string {
+	elapsed := (time.Duration(r.ElapsedMS) * time.Millisecond).Round(time.Millisecond)
+	dg := ""
+	if r.DataGuard != nil {
+		dg = ", " + dgText(r.DataGuard)
+	}
+	switch {
+	case !r.OK:
+		return fmt.Sprintf(" ERROR: %s\n", r.Error)
+	case r.Result != "" && r.DBHost != "":
+		return fmt.Sprintf(" OK-> %s, result: %s, %s%s\n", r.DBHost, r.Result, elapsed, dg)
+	case r.Result != "":
+		return fmt.Sprintf(" OK-> %s, %s%s\n", r.Result, elapsed, dg)
+	case dbhostFlag && r.DBHost != "":
+		// no host value with dummy credentials
+		return fmt.Sprintf(" OK-> %s, %s%s\n", r.DBHost, elapsed, dg)
+	default:
+		return fmt.Sprintf(" OK-> %s%s\n", elapsed, dg)
+	}
+}
+
+// writeCheckReport writes the check results as json, yaml or csv
+func writeCheckReport(w io.Writer, format string, report checkReport) (err error) {
+	if format != outputCSV {
+		return writeStructured(w, format, report)
+	}
+	// optional columns are only written if a result has a value for them
+	withAddress, withResult, withDG := false, false, false
+	for _, r := range report.Results {
+		withAddress = withAddress || r.Address != ""
+		withResult = withResult || r.Result != ""
+		withDG = withDG || r.DataGuard != nil
+	}
+	timing := withTiming(report.Results)
+	cw := csv.NewWriter(w)
+	header := []string{"name", "location", "ok", "elapsed_ms", "dbhost", "ora_code", "error"}
+	if withAddress {
+		header = append(header, "address")
+	}
+	if withResult {
+		header = append(header, "result")
+	}
+	if timing {
+		header = append(header, "dns_ms", "tcp_ms", "tls_ms", "tns_ms", "login_est_ms", "tns_reply")
+	}
+	if withDG {
+		header = append(header, "database_role", "apply_lag", "transport_lag")
+	}
+	err = cw.Write(header)
+	for _, r := range report.Results {
+		if err != nil {
+			return
+		}
+		code := ""
+		if r.OraCode > 0 {
+			code = fmt.Sprintf("%d", r.OraCode)
+		}
+		record := []string{r.Name, r.Location, fmt.Sprintf("%v", r.OK), fmt.Sprintf("%d", r.ElapsedMS), r.DBHost, code, r.Error}
+		if withAddress {
+			record = append(record, r.Address)
+		}
+		if withResult {
+			record = append(record, r.Result)
+		}
+		if timing {
+			record = append(record, timingRecord(r.Timing)...)
+		}
+		if withDG {
+			record = append(record, dgRecord(r.DataGuard)...)
+		}
+		err = cw.Write(record)
+	}
+	if err == nil {
+		// trailing summary row padded to the header width
+		summary := make([]string, len(header))
+		copy(summary, []string{"# summary",
+			fmt.Sprintf("checked=%d", report.Summary.Checked),
+			fmt.Sprintf("ok=%d", report.Summary.OK),
+			fmt.Sprintf("failed=%d", report.Summary.Failed)})
+		err = cw.Write(summary)
+	}
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return
+}
+
 func singleCheck(args []string, tnsEntries dblib.TNSEntries, domain string) (err error) {
 	// not all modus, we have to  check one single entry
 	// use first argument as service if is nothing given
@@ -399,6 +702,9 @@ func singleCheck(args []string, tnsEntries dblib.TNSEntries, domain string) (err
 	}
 	log.Debugf("get Entry for service %s ", tnsKey)
 	if entry, found := dblib.GetEntry(tnsKey, tnsEntries, domain); found {
+		if eachAddress {
+			return checkEachAddress(entry)
+		}
 		err = testService(entry)
 		return
 	}
@@ -415,16 +721,20 @@ func testService(entry dblib.TNSEntry) (err error) {
 	if len(dbUser) > 0 {
 		con = fmt.Sprintf("using user '%s'", dbUser)
 	}
-	ok, elapsed, hostval, errmsg := CheckWithOracle(dbUser, dbPass, desc, timeout)
+	q := healthQueryFor(tnsAlias)
+	ok, elapsed, hostval, errmsg := checkWithQuery(dbUser, dbPass, desc, timeout, q)
 	if ok {
 		hv := ""
 		if hostval != "" {
 			hv = "(" + hostval + ") "
 		}
 		log.Infof("service %s connected %s%s in %s\n", tnsKey, hv, con, elapsed.Round(time.Millisecond))
-		if dbhostFlag {
+		switch {
+		case q.SQL != "":
+			fmt.Printf("OK, service %s reachable, result: %s\n", tnsAlias, hostval)
+		case dbhostFlag:
 			fmt.Printf("%s -> %s\n", tnsKey, hostval)
-		} else {
+		default:
 			fmt.Printf("OK, service %s reachable\n", tnsAlias)
 		}
 	} else {
@@ -433,9 +743,28 @@ func testService(entry dblib.TNSEntry) (err error) {
 	return
 }
 
+// dbConnect opens the connection of a check, replaced by tests
+var dbConnect = oracleConnect
+
+// oracleConnect opens a connection to the descriptor, TCPS options are taken from sqlnet.ora
+func oracleConnect(dbuser string, dbpass string, tnsDesc string, timeout int) (*sql.DB, error) {
+	// jdbc url needs spaces stripped
+	tnsDesc = strings.Join(strings.Fields(tnsDesc), "")
+	urlOptions := dblib.SSLConnectOptions(tnsDesc)
+	url := goora.BuildJDBC(dbuser, dbpass, tnsDesc, urlOptions)
+	log.Debugf("Try to connect %s@%s", dbuser, tnsDesc)
+	return dblib.DBConnect("oracle", url, timeout)
+}
+
 // CheckWithOracle try connecting to oracle with dummy creds to get an ORA error.
 // If this happens, the connection is working
 func CheckWithOracle(dbuser string, dbpass string, tnsDesc string, timeout int) (ok bool, elapsed time.Duration, hostval string, err error) {
+	return checkWithQuery(dbuser, dbpass, tnsDesc, timeout, healthQuery{})
+}
+
+// checkWithQuery connects like CheckWithOracle and runs the health query if given.
+// A health query needs a real login, so ORA-01017 fails the check then
+func checkWithQuery(dbuser string, dbpass string, tnsDesc string, timeout int, q healthQuery) (ok bool, elapsed time.Duration, hostval string, err error) {
 	ok = false
 	if dbuser == "" {
 		dbuser = defaultUser
@@ -443,13 +772,8 @@ func CheckWithOracle(dbuser string, dbpass string, tnsDesc string, timeout int)
 	if dbpass == "" {
 		dbpass = defaultPassword
 	}
-	// jdbc url needs spaces stripped
-	tnsDesc = strings.Join(strings.Fields(tnsDesc), "")
-	urlOptions := dblib.SSLConnectOptions(tnsDesc)
-	url := goora.BuildJDBC(dbuser, dbpass, tnsDesc, urlOptions)
-	log.Debugf("Try to connect %s@%s", dbuser, tnsDesc)
 	start := time.Now()
-	db, err := dblib.DBConnect("oracle", url, timeout)
+	db, err := dbConnect(dbuser, dbpass, tnsDesc, timeout)
 	elapsed = time.Since(start)
 
 	// check results
@@ -457,20 +781,35 @@ func CheckWithOracle(dbuser string, dbpass string, tnsDesc string, timeout int)
 		// check error code, we expect 1017
 		isOerr, code, _ := dblib.HaveOerr(err)
 		if isOerr && code == 1017 {
+			if q.active() {
+				err = fmt.Errorf("health query needs a valid login: %v", err)
+				return
+			}
 			ok = true
 			log.Warnf("Connect OK, but Login error, maybe expected")
 		}
 	} else {
+		// the serve daemon checks every interval, do not keep a pool per check
+		defer func() { _ = db.Close() }()
 		log.Debugf("Connection OK, test if db is open using select")
-		sql := "select 'DB is open, sysdate:'||to_char(sysdate,'YYYY-MM-DD HH24:MI:SS') from dual"
+		query := "select 'DB is open, sysdate:'||to_char(sysdate,'YYYY-MM-DD HH24:MI:SS') from dual"
 		if dbhostFlag {
 			// extract host,cdb and pdb from database
-			sql = "select sys_context('USERENV','SERVER_HOST')||':'||sys_context('USERENV','INSTANCE_NAME')||':'||nvl(sys_context('USERENV','CON_NAME'),'') as dbhostFlag from dual"
+			query = dbhostSQL
 		}
-		hostval, err = dblib.SelectOneStringValue(db, sql)
+		if q.SQL != "" {
+			query = q.SQL
+		}
+		hostval, err = dblib.SelectOneStringValue(db, query)
 		log.Infof("Query returned:  %s", hostval)
+		if err == nil && q.assert != nil {
+			err = q.assert.check(hostval)
+		}
 		if err == nil {
 			ok = true
+			if q.inspect != nil {
+				q.inspect(db)
+			}
 		}
 	}
 	return
@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"strings"
 	"testing"
 
@@ -100,6 +103,87 @@ func TestOracleConnect(t *testing.T) {
 		assert.Contains(t, out, expect, "Expected Message not found")
 		all = false
 	})
+	t.Run("CMD parallel all Check with dummy", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdCheck,
+			flagFilename, tnsFilename,
+			"--all",
+			"--parallel", "2",
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.Errorf(t, err, "Check should fail")
+		expect := "2 entries checked, 1 ok, 1 failed"
+		assert.Contains(t, out, expect, "Expected Message not found")
+		all = false
+		parallel = 1
+	})
+	t.Run("CMD Check each address with dummy", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdCheck,
+			flagFilename, tnsFilename,
+			flagService, xealias,
+			"--each-address",
+			flagNodns,
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.NoErrorf(t, err, "Check should succeed")
+		expect := fmt.Sprintf("%s %s:%s: OK->", xealias, dbHost, dbPort)
+		assert.Contains(t, out, expect, "Expected address result not found")
+		assert.Contains(t, out, "1 addresses checked, 0 failed", "Expected summary not found")
+		eachAddress, dbhostFlag, nodns = false, false, false
+	})
+	t.Run("CMD Check timing with dummy", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdCheck,
+			flagFilename, tnsFilename,
+			flagService, xealias,
+			"--timing",
+			flagNodns,
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.NoErrorf(t, err, "Check should succeed")
+		assert.Contains(t, out, "WATERFALL", "Expected timing table not found")
+		assert.Contains(t, out, fmt.Sprintf("%s %s:%s", xealias, dbHost, dbPort), "Expected address not found")
+		timingFlag, eachAddress, dbhostFlag, nodns = false, false, false, false
+	})
+	t.Run("CMD Check dataguard", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdCheck,
+			flagFilename, tnsFilename,
+			flagService, xealias,
+			flagUser, dbSystemUser,
+			flagPassword, dbPassword,
+			"--dataguard",
+			"--dataguard-state", path.Join(t.TempDir(), "dataguard.json"),
+			flagNodns,
+			"--timeout", fmt.Sprintf("%d", dbTimeout),
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.NoErrorf(t, err, "Check should succeed")
+		assert.Contains(t, out, ", PRIMARY", "Expected database role not found")
+		assert.NotContains(t, out, "WARNING:", "no data guard warning expected")
+		dataguardFlag, dataguardState, eachAddress, dbhostFlag, nodns = false, "", false, false, false
+	})
 	t.Run("CMD Check with real user", func(t *testing.T) {
 		out := ""
 		args := []string{
@@ -119,6 +203,68 @@ func TestOracleConnect(t *testing.T) {
 		expect := fmt.Sprintf("service %s connected", xealias)
 		assert.Contains(t, out, expect, "Expected Message not found")
 	})
+	t.Run("CMD Check health query", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdCheck,
+			flagFilename, tnsFilename,
+			flagService, xealias,
+			flagUser, dbSystemUser,
+			flagPassword, dbPassword,
+			"--sql", "select open_mode from v$database",
+			"--expect", "READ WRITE",
+			"--timeout", fmt.Sprintf("%d", dbTimeout),
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.NoErrorf(t, err, "Check should succeed")
+		assert.Contains(t, out, "result: READ WRITE", "Expected result not found")
+	})
+	t.Run("CMD Check health query assertion fails", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdCheck,
+			flagFilename, tnsFilename,
+			flagService, xealias,
+			flagUser, dbSystemUser,
+			flagPassword, dbPassword,
+			"--sql", "select count(*) from dual",
+			"--expect", ">1",
+			"--timeout", fmt.Sprintf("%d", dbTimeout),
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		require.Errorf(t, err, "Check should fail")
+		assert.Contains(t, err.Error(), "result '1' does not match > 1", "Expected assertion error not found")
+		checkSQL, checkExpect = "", ""
+	})
+	t.Run("CMD DB info", func(t *testing.T) {
+		out := ""
+		args := []string{
+			cmdService,
+			cmdInfo,
+			"db",
+			flagFilename, tnsFilename,
+			flagService, xealias,
+			flagUser, dbSystemUser,
+			flagPassword, dbPassword,
+			"--timeout", fmt.Sprintf("%d", dbTimeout),
+			"--output", "json",
+			flagInfo,
+			flagUnitTest,
+		}
+		out, err = common.CmdRun(RootCmd, args)
+		t.Log(out)
+		assert.NoErrorf(t, err, "DB info should succeed")
+		assert.Contains(t, out, "is PRIMARY, READ WRITE", "Expected database state not found")
+		dbInfoOutput = outputText
+	})
 	t.Run("CMD false Check", func(t *testing.T) {
 		out := ""
 		args := []string{
@@ -283,3 +429,119 @@ func TestOracleConnect(t *testing.T) {
 		assert.Contains(t, out, "TIMEOUT", "Port result should contain TIMEOUT")
 	})
 }
+
+func TestCheckReport(t *testing.T) {
+	report := checkReport{
+		Results: []checkResult{
+			{Name: xealias, Location: "connect.ora Line: 1", OK: true, ElapsedMS: 12, OraCode: 1017, Error: "ORA-01017: invalid username/password"},
+			{Name: "TOTEST.local", Location: "connect.ora Line: 3", OK: false, ElapsedMS: 3001, Error: "dial tcp 8.8.8.7:1521: i/o timeout"},
+		},
+		Summary: checkSummary{Checked: 2, OK: 1, Failed: 1},
+	}
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := checkOutputFormat("xml", outputText, outputJSON, outputYAML, outputCSV)
+		assert.Error(t, err, "xml should be rejected")
+	})
+	t.Run("json", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeCheckReport(&sb, outputJSON, report)
+		require.NoErrorf(t, err, "json output failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, `"ora_code": 1017`, "ORA code missing")
+		assert.Contains(t, out, `"failed": 1`, "summary missing")
+	})
+	t.Run("yaml", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeCheckReport(&sb, outputYAML, report)
+		require.NoErrorf(t, err, "yaml output failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "name: "+xealias, "name missing")
+		assert.Contains(t, out, "checked: 2", "summary missing")
+	})
+	t.Run("csv", func(t *testing.T) {
+		var sb strings.Builder
+		err := writeCheckReport(&sb, outputCSV, report)
+		require.NoErrorf(t, err, "csv output failed: %s", err)
+		lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+		t.Log(sb.String())
+		assert.Equal(t, 4, len(lines), "header, 2 records and summary expected")
+		assert.Equal(t, "name,location,ok,elapsed_ms,dbhost,ora_code,error", lines[0], "header not expected")
+		assert.True(t, strings.HasPrefix(lines[2], "TOTEST.local,connect.ora Line: 3,false,3001,,,"), "record not expected")
+		assert.Equal(t, "# summary,checked=2,ok=1,failed=1,,,", lines[3], "summary not expected")
+	})
+	t.Run("output needs all", func(t *testing.T) {
+		savedAll, savedOutput := all, checkOutput
+		all, checkOutput = false, outputJSON
+		err := checkTns(nil, []string{xealias})
+		all, checkOutput = savedAll, savedOutput
+		assert.ErrorContains(t, err, "needs --all", "output without --all should be rejected")
+	})
+}
+
+// stubDriver answers every query with one row holding value
+type stubDriver struct{ value string }
+type stubConn struct{ value string }
+type stubStmt struct{ value string }
+type stubRows struct {
+	value string
+	done  bool
+}
+
+func (d stubDriver) Open(string) (driver.Conn, error)  { return stubConn(d), nil }
+func (c stubConn) Prepare(string) (driver.Stmt, error) { return stubStmt(c), nil }
+func (c stubConn) Close() error                        { return nil }
+func (c stubConn) Begin() (driver.Tx, error)           { return nil, fmt.Errorf("not supported") }
+func (s stubStmt) Close() error                        { return nil }
+func (s stubStmt) NumInput() int                       { return -1 }
+func (s stubStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (s stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &stubRows{value: s.value}, nil
+}
+func (r *stubRows) Columns() []string { return []string{"value"} }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func TestCheckConnection(t *testing.T) {
+	sql.Register("tnscli_stub", stubDriver{value: "node1:CDB1:PDB1"})
+	var db *sql.DB
+	dbConnect = func(string, string, string, int) (*sql.DB, error) {
+		var err error
+		db, err = sql.Open("tnscli_stub", "")
+		return db, err
+	}
+	defer func() { dbConnect = oracleConnect }()
+	t.Run("close after check", func(t *testing.T) {
+		inspected := false
+		q := healthQuery{inspect: func(d *sql.DB) {
+			inspected = true
+			assert.NoError(t, d.Ping(), "connection should be open for inspect")
+		}}
+		ok, _, _, err := checkWithQuery("user", "pass", xetest, 1, q)
+		require.NoErrorf(t, err, "check failed: %s", err)
+		assert.True(t, ok, "check should succeed")
+		assert.True(t, inspected, "inspect not called")
+		require.NotNil(t, db, "no connection opened")
+		assert.Error(t, db.Ping(), "connection not closed after check")
+	})
+	t.Run("node with health query", func(t *testing.T) {
+		savedQueries, savedHost := healthQueries, dbhostFlag
+		healthQueries, dbhostFlag = []healthQuery{{SQL: "select open_mode from v$database"}}, true
+		r := checkAlias(dblib.TNSEntry{Name: "RAC.lan", Desc: xetest})
+		healthQueries, dbhostFlag = savedQueries, savedHost
+		require.True(t, r.OK, "check should succeed")
+		assert.Equal(t, "node1:CDB1:PDB1", r.DBHost, "node missing with health query")
+		r.Result = "READ WRITE"
+		assert.Equal(t, " OK-> node1:CDB1:PDB1, result: READ WRITE, 0s\n", checkResultText(r), "node and result expected")
+	})
+}
@@ -0,0 +1,173 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/tommi2day/gomodules/dblib"
+	"github.com/tommi2day/gomodules/netlib"
+)
+
+var eachAddress = false
+
+// descriptor parameters which choose between addresses and are dropped
+// when an entry is split into single address descriptors
+var addressSelectors = map[string]bool{
+	"ADDRESS":      true,
+	"ADDRESS_LIST": true,
+	"LOAD_BALANCE": true,
+	"FAILOVER":     true,
+	"SOURCE_ROUTE": true,
+}
+
+func init() {
+	checkCmd.Flags().BoolVar(&eachAddress, "each-address", false, "check every address and RAC node of an entry on its own, implies --dbhost")
+	checkCmd.Flags().StringVarP(&racinfo, "racinfo", "r", "", "path to racinfo.ini to resolve RAC addresses for --each-address, default $TNS_ADMIN/racinfo.ini")
+	checkCmd.Flags().BoolVar(&nodns, "nodns", false, "do not use DNS to resolve RAC addresses for --each-address")
+}
+
+// addressResolver returns the function expanding an address to its RAC addresses
+func addressResolver() func(dblib.TNSAddress) dblib.ServiceEntries {
+	if racinfo == "" {
+		racinfo = path.Join(viper.GetString("tns_admin"), racinfoFile)
+	}
+	dblib.IgnoreDNSLookup = nodns
+	dns := netlib.NewResolver("", 0, false)
+	return func(a dblib.TNSAddress) dblib.ServiceEntries {
+		return getServices(dns, []dblib.TNSAddress{a})
+	}
+}
+
+// splitAddresses returns one entry per address of the given entry including the
+// RAC addresses. Each descriptor keeps CONNECT_DATA, SECURITY and all other
+// parameters of its DESCRIPTION but has exactly one ADDRESS, so LOAD_BALANCE and
+// FAILOVER cannot hide a dead node. The entries are keyed by alias and address
+func splitAddresses(entry dblib.TNSEntry, resolve func(dblib.TNSAddress) dblib.ServiceEntries) (entries dblib.TNSEntries, keys []string, err error) {
+	nodes, err := parseDescriptor(entry.Desc, 1)
+	if err != nil {
+		err = fmt.Errorf("cannot split descriptor of %s: %v", entry.Name, err)
+		return
+	}
+	entries = dblib.TNSEntries{}
+	for _, d := range findNodes(nodes, "DESCRIPTION") {
+		for _, a := range findNodes(d.Children, "ADDRESS") {
+			protocol, _ := a.childValue("PROTOCOL")
+			host, _ := a.childValue("HOST")
+			port, _ := a.childValue("PORT")
+			if host == "" {
+				continue
+			}
+			if protocol == "" {
+				protocol = "TCP"
+			}
+			for _, s := range resolve(dblib.TNSAddress{Host: host, Port: port}) {
+				address := s.Address
+				if address == "" {
+					address = s.Host + ":" + s.Port
+				}
+				key := entry.Name + " " + address
+				if _, ok := entries[key]; ok {
+					continue
+				}
+				entries[key] = dblib.TNSEntry{
+					Name:     entry.Name,
+					Location: entry.Location,
+					File:     entry.File,
+					Service:  entry.Service,
+					Servers:  []dblib.TNSAddress{{Host: s.Host, Port: s.Port}},
+					Desc:     singleAddressDesc(d, protocol, s.Host, s.Port),
+				}
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		err = fmt.Errorf("no address with HOST found in %s", entry.Name)
+	}
+	return
+}
+
+// singleAddressDesc builds a descriptor from d with the given address only
+func singleAddressDesc(d *tnsNode, protocol string, host string, port string) string {
+	var sb strings.Builder
+	sb.WriteString("(DESCRIPTION=(ADDRESS=(PROTOCOL=" + protocol + ")(HOST=" + host + ")(PORT=" + port + "))")
+	for _, c := range d.Children {
+		if !addressSelectors[strings.ToUpper(c.Key)] {
+			sb.WriteString(c.inline())
+		}
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// expandAddresses replaces every entry by its single address entries. Entries
+// which cannot be split are kept and checked as a whole. addresses maps the
+// returned keys to the address checked
+func expandAddresses(tnsEntries dblib.TNSEntries, keys []string, resolve func(dblib.TNSAddress) dblib.ServiceEntries) (expanded dblib.TNSEntries, expandedKeys []string, addresses map[string]string) {
+	expanded = dblib.TNSEntries{}
+	addresses = map[string]string{}
+	for _, k := range keys {
+		entries, split, err := splitAddresses(tnsEntries[k], resolve)
+		if err != nil {
+			log.Warnf("%v, check it as a whole", err)
+			expanded[k] = tnsEntries[k]
+			expandedKeys = append(expandedKeys, k)
+			continue
+		}
+		for _, s := range split {
+			expanded[s] = entries[s]
+			addresses[s] = strings.TrimPrefix(s, entries[s].Name+" ")
+		}
+		expandedKeys = append(expandedKeys, split...)
+	}
+	log.Debugf("%d entries expanded to %d addresses", len(keys), len(expandedKeys))
+	return
+}
+
+// checkEachAddress checks all addresses of one entry and prints the status per node
+func checkEachAddress(entry dblib.TNSEntry) (err error) {
+	entries, keys, addresses := expandAddresses(dblib.TNSEntries{entry.Name: entry}, []string{entry.Name}, addressResolver())
+	results := runChecks(entries, keys, parallel)
+	failed := 0
+	checked := make([]checkResult, 0, len(keys))
+	for i := range keys {
+		r := <-results[i]
+		r.Address = addresses[keys[i]]
+		checked = append(checked, r)
+		fmt.Printf("%s: ", checkLabel(r))
+		printCheckResult(r)
+		if !r.OK {
+			failed++
+		}
+	}
+	if withTiming(checked) {
+		if err = writeTimingTable(os.Stdout, checked); err != nil {
+			return
+		}
+	}
+	if dataguardFlag {
+		var warnings []string
+		if warnings, err = checkDataGuard(checked, loadBalanced(dblib.TNSEntries{entry.Name: entry})); err != nil {
+			return
+		}
+		printDataGuardWarnings(warnings)
+	}
+	log.Infof("%s: %d addresses checked, %d failed", entry.Name, len(keys), failed)
+	if failed > 0 {
+		err = fmt.Errorf("service %s: %d of %d addresses NOT reached", entry.Name, failed, len(keys))
+	}
+	return
+}
+
+// checkLabel names a result by alias and the address checked, if any
+func checkLabel(r checkResult) string {
+	if r.Address == "" {
+		return r.Name
+	}
+	return r.Name + " " + r.Address
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestEachAddress(t *testing.T) {
+	const racdesc = `(DESCRIPTION=(CONNECT_TIMEOUT=5)(FAILOVER=on)(LOAD_BALANCE=on)
+  (ADDRESS_LIST=(ADDRESS=(PROTOCOL=TCPS)(HOST=scan.rac.lan)(PORT=2484))(ADDRESS=(PROTOCOL=TCP)(HOST=db2)(PORT=1521)))
+  (CONNECT_DATA=(SERVICE_NAME=rac.lan))(SECURITY=(SSL_SERVER_DN_MATCH=yes)))`
+	entry := dblib.TNSEntry{Name: "RAC.lan", Location: "rac.ora Line: 1", Desc: racdesc}
+	// scan.rac.lan resolves to two VIPs, db2 to itself
+	resolve := func(a dblib.TNSAddress) dblib.ServiceEntries {
+		if a.Host == "scan.rac.lan" {
+			return dblib.ServiceEntries{
+				{Host: "vip1.rac.lan", Port: a.Port, Address: "10.0.0.1:" + a.Port},
+				{Host: "vip2.rac.lan", Port: a.Port, Address: "10.0.0.2:" + a.Port},
+				{Host: "vip1.rac.lan", Port: a.Port, Address: "10.0.0.1:" + a.Port},
+			}
+		}
+		return dblib.ServiceEntries{{Host: a.Host, Port: a.Port, Address: a.Host + ":" + a.Port}}
+	}
+
+	t.Run("split", func(t *testing.T) {
+		entries, keys, err := splitAddresses(entry, resolve)
+		require.NoErrorf(t, err, "split failed: %s", err)
+		require.Equal(t, []string{"RAC.lan 10.0.0.1:2484", "RAC.lan 10.0.0.2:2484", "RAC.lan db2:1521"}, keys, "duplicate VIP should be removed")
+		desc := entries[keys[1]].Desc
+		t.Log(desc)
+		assert.True(t, strings.HasPrefix(desc, "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCPS)(HOST=vip2.rac.lan)(PORT=2484))"), "single address expected")
+		assert.NotContains(t, desc, "FAILOVER", "FAILOVER should be removed")
+		assert.NotContains(t, desc, "LOAD_BALANCE", "LOAD_BALANCE should be removed")
+		assert.NotContains(t, desc, "scan.rac.lan", "original address should be removed")
+		assert.Contains(t, desc, "(CONNECT_TIMEOUT = 5)", "parameters should be kept")
+		assert.Contains(t, desc, "(SECURITY = (SSL_SERVER_DN_MATCH = yes))", "SECURITY should be kept")
+		assert.Contains(t, entries[keys[2]].Desc, "(PROTOCOL=TCP)(HOST=db2)(PORT=1521)", "protocol of db2 expected")
+		assert.Equal(t, entry.Name, entries[keys[2]].Name, "alias should be kept")
+		_, err = parseDescriptor(desc, 1)
+		assert.NoErrorf(t, err, "split descriptor should be valid: %s", err)
+	})
+	t.Run("expand", func(t *testing.T) {
+		broken := dblib.TNSEntry{Name: "BROKEN.lan", Desc: "(DESCRIPTION=((CONNECT_TIMEOUT=3))"}
+		tnsEntries := dblib.TNSEntries{"RAC.lan": entry, "BROKEN.lan": broken}
+		expanded, keys, addresses := expandAddresses(tnsEntries, []string{"BROKEN.lan", "RAC.lan"}, resolve)
+		require.Len(t, keys, 4, "broken entry and 3 addresses expected")
+		assert.Equal(t, "BROKEN.lan", keys[0], "broken entry should be checked as a whole")
+		assert.Equal(t, broken.Desc, expanded[keys[0]].Desc)
+		assert.Empty(t, addresses[keys[0]], "no address for broken entry")
+		assert.Equal(t, "10.0.0.1:2484", addresses[keys[1]])
+		assert.Equal(t, "RAC.lan 10.0.0.1:2484", checkLabel(checkResult{Name: "RAC.lan", Address: addresses[keys[1]]}))
+	})
+	t.Run("csv address column", func(t *testing.T) {
+		report := checkReport{Results: []checkResult{{Name: "RAC.lan", Location: "rac.ora Line: 1", Address: "10.0.0.1:2484", OK: true, ElapsedMS: 5, DBHost: "node1:RAC1:PDB1"}}}
+		var sb strings.Builder
+		err := writeCheckReport(&sb, outputCSV, report)
+		require.NoErrorf(t, err, "csv output failed: %s", err)
+		lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+		require.Len(t, lines, 3, "header, 1 record and summary expected")
+		assert.True(t, strings.HasSuffix(lines[0], ",error,address"), "address column expected")
+		assert.True(t, strings.HasSuffix(lines[1], ",node1:RAC1:PDB1,,,10.0.0.1:2484"), "record not expected")
+	})
+}
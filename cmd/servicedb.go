@@ -0,0 +1,233 @@
+// Package cmd commands
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+var dbInfoCmd = &cobra.Command{
+	Use:   "db [alias]",
+	Short: "print role, open mode, version, instances and services of the database",
+	Long: `login to the database of the service and print DB_UNIQUE_NAME, database role, open mode,
+version banner, the instances from gv$instance and the active services. Needs a real user
+with select privileges on v$database, v$version, gv$instance and gv$active_services`,
+	RunE:         getDBInfo,
+	SilenceUsage: true,
+}
+
+// inventory queries, each must return the columns scanned by collectDBInfo
+const (
+	dbDatabaseSQL   = "select db_unique_name, database_role, open_mode from v$database"
+	dbBannerFullSQL = "select banner_full from v$version"
+	dbBannerSQL     = "select banner from v$version where banner like 'Oracle%'"
+	dbInstancesSQL  = "select inst_id, instance_name, host_name, status, version from gv$instance order by inst_id"
+	dbServicesSQL   = "select distinct name from gv$active_services order by name"
+)
+
+var dbInfoOutput = outputText
+
+// dbInfo is the inventory of the database behind an alias
+type dbInfo struct {
+	Alias string `json:"alias" yaml:"alias"`
+	// Connected is host:instance:container of the session like --dbhost
+	Connected    string       `json:"connected" yaml:"connected"`
+	DBUniqueName string       `json:"db_unique_name,omitempty" yaml:"db_unique_name,omitempty"`
+	Role         string       `json:"database_role,omitempty" yaml:"database_role,omitempty"`
+	OpenMode     string       `json:"open_mode,omitempty" yaml:"open_mode,omitempty"`
+	Version      string       `json:"version,omitempty" yaml:"version,omitempty"`
+	Instances    []dbInstance `json:"instances" yaml:"instances"`
+	Services     []string     `json:"services" yaml:"services"`
+	// Warnings lists the queries which failed, e.g. for missing privileges
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// dbInstance is one row of gv$instance
+type dbInstance struct {
+	ID      int    `json:"inst_id" yaml:"inst_id"`
+	Name    string `json:"instance_name" yaml:"instance_name"`
+	Host    string `json:"host_name" yaml:"host_name"`
+	Status  string `json:"status" yaml:"status"`
+	Version string `json:"version" yaml:"version"`
+}
+
+// dbQuerier returns all rows of a query as strings
+type dbQuerier func(query string) ([][]string, error)
+
+func init() {
+	dbInfoCmd.Flags().StringVarP(&dbUser, "user", "u", dbUser, "User for real connect or set TNSCLI_USER")
+	dbInfoCmd.Flags().StringVarP(&dbPass, "password", "p", dbPass, "Password for real connect or set TNSCLI_PASSWORD")
+	dbInfoCmd.Flags().IntVarP(&timeout, "timeout", "t", timeout, "timeout in sec")
+	dbInfoCmd.Flags().StringVarP(&dbInfoOutput, "output", "o", dbInfoOutput, "output format: text, json or yaml")
+	infoCmd.AddCommand(dbInfoCmd)
+}
+
+func getDBInfo(_ *cobra.Command, args []string) (err error) {
+	format, err := checkOutputFormat(dbInfoOutput, outputText, outputJSON, outputYAML)
+	if err != nil {
+		return
+	}
+	if tnsKey == "" {
+		if len(args) == 0 {
+			err = fmt.Errorf("dont have a service to check, use --service to provide")
+			return
+		}
+		tnsKey = args[0]
+	}
+	if dbUser == "" {
+		dbUser = common.GetEnv("TNSCLI_USER", "")
+	}
+	if dbPass == "" {
+		dbPass = common.GetEnv("TNSCLI_PASSWORD", "")
+	}
+	if dbUser == "" || dbPass == "" {
+		err = fmt.Errorf("service info db needs a real login, use --user and --password or set TNSCLI_USER and TNSCLI_PASSWORD")
+		return
+	}
+	dblib.TNSSSLconfig.WalletPassword = common.GetEnv("TNSCLI_WALLET_PASSWORD", "")
+	entry, err := getEntry(tnsKey)
+	if err != nil {
+		return
+	}
+	db, err := oracleConnect(dbUser, dbPass, entry.Desc, timeout)
+	if err != nil {
+		err = fmt.Errorf("service %s NOT reached: %v", entry.Name, err)
+		return
+	}
+	defer func() { _ = db.Close() }()
+	info, err := collectDBInfo(entry.Name, sqlQuerier(db))
+	if err != nil {
+		return
+	}
+	log.Infof("service %s: database %s is %s, %s", info.Alias, info.DBUniqueName, info.Role, info.OpenMode)
+	if format == outputText {
+		return writeDBInfo(os.Stdout, info)
+	}
+	return writeStructured(os.Stdout, format, info)
+}
+
+// sqlQuerier runs queries on db, NULL values are returned as empty strings
+func sqlQuerier(db *sql.DB) dbQuerier {
+	return func(query string) (result [][]string, err error) {
+		rows, err := db.Query(query)
+		if err != nil {
+			return
+		}
+		defer func() { _ = rows.Close() }()
+		cols, err := rows.Columns()
+		if err != nil {
+			return
+		}
+		for rows.Next() {
+			values := make([]sql.NullString, len(cols))
+			dest := make([]any, len(cols))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err = rows.Scan(dest...); err != nil {
+				return
+			}
+			row := make([]string, len(cols))
+			for i, v := range values {
+				row[i] = v.String
+			}
+			result = append(result, row)
+		}
+		err = rows.Err()
+		return
+	}
+}
+
+// collectDBInfo runs the inventory queries. Only the session query must succeed,
+// all other failures are reported as warnings
+func collectDBInfo(alias string, query dbQuerier) (info dbInfo, err error) {
+	info = dbInfo{Alias: alias, Instances: []dbInstance{}, Services: []string{}}
+	rows, err := query(dbhostSQL)
+	if err == nil && len(rows) == 0 {
+		err = fmt.Errorf("no rows")
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot query session of %s: %v", alias, err)
+		return
+	}
+	info.Connected = rows[0][0]
+	warn := func(view string, e error) {
+		log.Warnf("cannot query %s: %v", view, e)
+		info.Warnings = append(info.Warnings, fmt.Sprintf("%s: %v", view, e))
+	}
+	if rows, e := query(dbDatabaseSQL); e != nil {
+		warn("v$database", e)
+	} else if len(rows) > 0 {
+		info.DBUniqueName, info.Role, info.OpenMode = rows[0][0], rows[0][1], rows[0][2]
+	}
+	// banner_full exists since 18c, older versions have the version in banner
+	rows, e := query(dbBannerFullSQL)
+	if e != nil {
+		rows, e = query(dbBannerSQL)
+	}
+	if e != nil {
+		warn("v$version", e)
+	} else if len(rows) > 0 {
+		info.Version = strings.Join(strings.Fields(rows[0][0]), " ")
+	}
+	if rows, e := query(dbInstancesSQL); e != nil {
+		warn("gv$instance", e)
+	} else {
+		for _, r := range rows {
+			id, _ := strconv.Atoi(r[0])
+			info.Instances = append(info.Instances, dbInstance{ID: id, Name: r[1], Host: r[2], Status: r[3], Version: r[4]})
+		}
+	}
+	if rows, e := query(dbServicesSQL); e != nil {
+		warn("gv$active_services", e)
+	} else {
+		for _, r := range rows {
+			info.Services = append(info.Services, r[0])
+		}
+	}
+	return
+}
+
+// writeDBInfo prints the inventory with the instances as table
+func writeDBInfo(w io.Writer, info dbInfo) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, kv := range [][2]string{
+		{"alias", info.Alias},
+		{"connected", info.Connected},
+		{"db_unique_name", info.DBUniqueName},
+		{"database_role", info.Role},
+		{"open_mode", info.OpenMode},
+		{"version", info.Version},
+		{"services", strings.Join(info.Services, ", ")},
+	} {
+		_, _ = fmt.Fprintf(tw, "%s:\t%s\n", kv[0], dashValue(kv[1]))
+	}
+	if err = tw.Flush(); err != nil {
+		return
+	}
+	if len(info.Instances) > 0 {
+		_, _ = fmt.Fprintln(w, "instances:")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "  INST_ID\tINSTANCE\tHOST\tSTATUS\tVERSION")
+		for _, i := range info.Instances {
+			_, _ = fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\n", i.ID, i.Name, i.Host, i.Status, i.Version)
+		}
+		if err = tw.Flush(); err != nil {
+			return
+		}
+	}
+	for _, warning := range info.Warnings {
+		_, err = fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	return
+}
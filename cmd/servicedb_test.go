@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBInfo(t *testing.T) {
+	// results of a two node RAC, banner_full is missing like before 18c
+	results := map[string][][]string{
+		dbhostSQL:      {{"racnode1:RAC1:PDB1"}},
+		dbDatabaseSQL:  {{"RAC_SITE1", "PRIMARY", "READ WRITE"}},
+		dbBannerSQL:    {{"Oracle Database 12c Enterprise Edition Release 12.2.0.1.0 - 64bit Production"}},
+		dbInstancesSQL: {{"1", "RAC1", "racnode1", "OPEN", "12.2.0.1.0"}, {"2", "RAC2", "racnode2", "OPEN", "12.2.0.1.0"}},
+	}
+	query := func(q string) ([][]string, error) {
+		if r, ok := results[q]; ok {
+			return r, nil
+		}
+		return nil, fmt.Errorf("ORA-00942: table or view does not exist")
+	}
+
+	t.Run("collect", func(t *testing.T) {
+		info, err := collectDBInfo("RAC.lan", query)
+		require.NoErrorf(t, err, "collect failed: %s", err)
+		assert.Equal(t, "racnode1:RAC1:PDB1", info.Connected)
+		assert.Equal(t, "RAC_SITE1", info.DBUniqueName)
+		assert.Equal(t, "PRIMARY", info.Role)
+		assert.Equal(t, "READ WRITE", info.OpenMode)
+		assert.Contains(t, info.Version, "Release 12.2.0.1.0", "banner fallback expected")
+		require.Len(t, info.Instances, 2, "2 instances expected")
+		assert.Equal(t, dbInstance{ID: 2, Name: "RAC2", Host: "racnode2", Status: "OPEN", Version: "12.2.0.1.0"}, info.Instances[1])
+		assert.Empty(t, info.Services, "services should fail")
+		require.Len(t, info.Warnings, 1, "one warning expected")
+		assert.Contains(t, info.Warnings[0], "gv$active_services: ORA-00942")
+	})
+	t.Run("text", func(t *testing.T) {
+		results[dbServicesSQL] = [][]string{{"RAC.lan"}, {"RAC_SITE1"}}
+		info, err := collectDBInfo("RAC.lan", query)
+		require.NoErrorf(t, err, "collect failed: %s", err)
+		var sb strings.Builder
+		err = writeDBInfo(&sb, info)
+		require.NoErrorf(t, err, "write failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "database_role:   PRIMARY")
+		assert.Contains(t, out, "services:        RAC.lan, RAC_SITE1")
+		assert.Contains(t, out, "  2        RAC2      racnode2  OPEN")
+		assert.NotContains(t, out, "warning:", "no warnings expected")
+	})
+	t.Run("json", func(t *testing.T) {
+		info, err := collectDBInfo("RAC.lan", query)
+		require.NoErrorf(t, err, "collect failed: %s", err)
+		var sb strings.Builder
+		err = writeStructured(&sb, outputJSON, info)
+		require.NoErrorf(t, err, "json failed: %s", err)
+		assert.Contains(t, sb.String(), `"database_role": "PRIMARY"`)
+		assert.Contains(t, sb.String(), `"host_name": "racnode2"`)
+	})
+	t.Run("session query fails", func(t *testing.T) {
+		delete(results, dbhostSQL)
+		_, err := collectDBInfo("RAC.lan", query)
+		assert.ErrorContains(t, err, "cannot query session of RAC.lan")
+	})
+}
@@ -0,0 +1,223 @@
+// Package cmd commands
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+// data guard queries, v$dataguard_stats has no rows on a primary without standby
+const (
+	dgRoleSQL = "select database_role, db_unique_name from v$database"
+	dgLagSQL  = "select name, value from v$dataguard_stats where name in ('apply lag','transport lag')"
+)
+
+const dgPrimary = "PRIMARY"
+
+var dataguardFlag = false
+var dataguardState = ""
+
+// dgStatus is the data guard state of the database reached by an address
+type dgStatus struct {
+	Role         string `json:"database_role,omitempty" yaml:"database_role,omitempty"`
+	DBUniqueName string `json:"db_unique_name,omitempty" yaml:"db_unique_name,omitempty"`
+	ApplyLag     string `json:"apply_lag,omitempty" yaml:"apply_lag,omitempty"`
+	TransportLag string `json:"transport_lag,omitempty" yaml:"transport_lag,omitempty"`
+	Error        string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// dgStateEntry is the role of an address seen by the last run
+type dgStateEntry struct {
+	Role         string    `json:"database_role"`
+	DBUniqueName string    `json:"db_unique_name"`
+	Checked      time.Time `json:"checked"`
+}
+
+func init() {
+	checkCmd.Flags().BoolVar(&dataguardFlag, "dataguard", false, "report database role and apply lag of every address and warn about standby connects and role transitions, implies --each-address")
+	checkCmd.Flags().StringVar(&dataguardState, "dataguard-state", "", "file to keep the roles for --dataguard between runs, default check.dataguard_state or tnscli/dataguard.json in the user cache dir")
+}
+
+// dataguardStateFile returns the configured state file or the default in the user cache dir
+func dataguardStateFile() string {
+	if dataguardState == "" {
+		dataguardState = viper.GetString("check.dataguard_state")
+	}
+	if dataguardState == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		dataguardState = filepath.Join(dir, "tnscli", "dataguard.json")
+	}
+	return dataguardState
+}
+
+// collectDataGuard queries role and lags. A failed lag query leaves the lags empty,
+// the role is required
+func collectDataGuard(query dbQuerier) (dg *dgStatus) {
+	dg = &dgStatus{}
+	rows, err := query(dgRoleSQL)
+	if err == nil && len(rows) == 0 {
+		err = fmt.Errorf("no rows")
+	}
+	if err != nil {
+		dg.Error = fmt.Sprintf("cannot query database role: %v", err)
+		return
+	}
+	dg.Role, dg.DBUniqueName = rows[0][0], rows[0][1]
+	rows, err = query(dgLagSQL)
+	if err != nil {
+		log.Warnf("cannot query v$dataguard_stats: %v", err)
+		return
+	}
+	for _, r := range rows {
+		switch r[0] {
+		case "apply lag":
+			dg.ApplyLag = r[1]
+		case "transport lag":
+			dg.TransportLag = r[1]
+		}
+	}
+	return
+}
+
+// dgText returns the role and lags of a result for the text output
+func dgText(dg *dgStatus) string {
+	if dg == nil {
+		return ""
+	}
+	if dg.Error != "" {
+		return "role unknown: " + dg.Error
+	}
+	text := dg.Role
+	if dg.ApplyLag != "" {
+		text += ", apply lag " + dg.ApplyLag
+	}
+	if dg.TransportLag != "" {
+		text += ", transport lag " + dg.TransportLag
+	}
+	return text
+}
+
+// dataguardLanding warns for every alias whose first reachable address is not
+// a primary. The addresses are tried in descriptor order like with FAILOVER, the
+// balanced aliases pick a random address and are skipped
+func dataguardLanding(results []checkResult, balanced map[string]bool) (warnings []string) {
+	landed := map[string]bool{}
+	for _, r := range results {
+		if landed[r.Name] || !r.OK {
+			continue
+		}
+		if balanced[r.Name] {
+			log.Debugf("%s uses LOAD_BALANCE, no landing address", r.Name)
+			continue
+		}
+		landed[r.Name] = true
+		switch {
+		case r.DataGuard == nil || r.DataGuard.Error != "":
+			continue
+		case r.DataGuard.Role != dgPrimary:
+			warnings = append(warnings, fmt.Sprintf("%s currently connects to %s %s at %s", r.Name, r.DataGuard.Role, r.DataGuard.DBUniqueName, dashValue(r.Address)))
+		}
+	}
+	return
+}
+
+// dataguardTransitions compares the roles with the last run and updates state.
+// Addresses without a role keep their last state to detect a transition after a downtime
+func dataguardTransitions(results []checkResult, state map[string]dgStateEntry, now time.Time) (warnings []string) {
+	for _, r := range results {
+		if r.DataGuard == nil || r.DataGuard.Role == "" {
+			continue
+		}
+		key := checkLabel(r)
+		last, found := state[key]
+		if found && last.Role != r.DataGuard.Role {
+			warnings = append(warnings, fmt.Sprintf("%s changed role from %s to %s since %s", key, last.Role, r.DataGuard.Role, last.Checked.Format(time.RFC3339)))
+		}
+		state[key] = dgStateEntry{Role: r.DataGuard.Role, DBUniqueName: r.DataGuard.DBUniqueName, Checked: now}
+	}
+	return
+}
+
+// loadBalanced returns the names of the entries whose descriptor enables LOAD_BALANCE
+func loadBalanced(tnsEntries dblib.TNSEntries) (balanced map[string]bool) {
+	balanced = map[string]bool{}
+	for _, e := range tnsEntries {
+		nodes, err := parseDescriptor(e.Desc, 1)
+		if err != nil {
+			continue
+		}
+		for _, n := range findNodes(nodes, "LOAD_BALANCE") {
+			switch strings.ToLower(n.Value) {
+			case "on", "yes", "true":
+				balanced[e.Name] = true
+			}
+		}
+	}
+	return
+}
+
+// checkDataGuard returns the data guard warnings of the results and saves the roles
+// to the state file. balanced are the aliases without a fixed address order
+func checkDataGuard(results []checkResult, balanced map[string]bool) (warnings []string, err error) {
+	file := dataguardStateFile()
+	state := map[string]dgStateEntry{}
+	content, err := os.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+		log.Debugf("no data guard state in %s, first run", file)
+		err = nil
+	case err != nil:
+		err = fmt.Errorf("cannot read data guard state: %v", err)
+		return
+	default:
+		if err = json.Unmarshal(content, &state); err != nil {
+			err = fmt.Errorf("invalid data guard state %s: %v", file, err)
+			return
+		}
+	}
+	warnings = append(dataguardLanding(results, balanced), dataguardTransitions(results, state, time.Now())...)
+	for _, w := range warnings {
+		log.Warn(w)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		err = fmt.Errorf("cannot create data guard state directory: %v", err)
+		return
+	}
+	content, err = json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = common.WriteStringToFile(file, string(content)+"\n"); err != nil {
+		err = fmt.Errorf("cannot write data guard state %s: %v", file, err)
+		return
+	}
+	log.Debugf("data guard state of %d addresses written to %s", len(state), file)
+	return
+}
+
+// printDataGuardWarnings prints the warnings after the check results
+func printDataGuardWarnings(warnings []string) {
+	for _, w := range warnings {
+		fmt.Printf("WARNING: %s\n", w)
+	}
+}
+
+// dgRecord returns the csv columns of a data guard state, empty without state
+func dgRecord(dg *dgStatus) []string {
+	if dg == nil {
+		return make([]string, 3)
+	}
+	return []string{dg.Role, dg.ApplyLag, dg.TransportLag}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestDataGuard(t *testing.T) {
+	primary := &dgStatus{Role: "PRIMARY", DBUniqueName: "DB_SITE1"}
+	standby := &dgStatus{Role: "PHYSICAL STANDBY", DBUniqueName: "DB_SITE2", ApplyLag: "+00 00:00:03", TransportLag: "+00 00:00:00"}
+
+	t.Run("collect", func(t *testing.T) {
+		query := func(q string) ([][]string, error) {
+			switch q {
+			case dgRoleSQL:
+				return [][]string{{"PHYSICAL STANDBY", "DB_SITE2"}}, nil
+			case dgLagSQL:
+				return [][]string{{"transport lag", "+00 00:00:00"}, {"apply lag", "+00 00:00:03"}}, nil
+			}
+			return nil, fmt.Errorf("unexpected query %s", q)
+		}
+		dg := collectDataGuard(query)
+		assert.Equal(t, standby, dg)
+		assert.Equal(t, "PHYSICAL STANDBY, apply lag +00 00:00:03, transport lag +00 00:00:00", dgText(dg))
+	})
+	t.Run("collect without privileges", func(t *testing.T) {
+		dg := collectDataGuard(func(_ string) ([][]string, error) {
+			return nil, fmt.Errorf("ORA-00942: table or view does not exist")
+		})
+		assert.Empty(t, dg.Role)
+		assert.Contains(t, dg.Error, "cannot query database role: ORA-00942")
+		assert.True(t, strings.HasPrefix(dgText(dg), "role unknown:"))
+	})
+	t.Run("landing", func(t *testing.T) {
+		results := []checkResult{
+			{Name: "DB.lan", Address: "db1:1521", OK: false, Error: "ORA-12541: TNS:no listener"},
+			{Name: "DB.lan", Address: "db2:1521", OK: true, DataGuard: standby},
+			{Name: "OK.lan", Address: "db3:1521", OK: true, DataGuard: primary},
+			{Name: "OK.lan", Address: "db4:1521", OK: true, DataGuard: standby},
+		}
+		warnings := dataguardLanding(results, nil)
+		require.Len(t, warnings, 1, "only DB.lan should land on a standby")
+		assert.Equal(t, "DB.lan currently connects to PHYSICAL STANDBY DB_SITE2 at db2:1521", warnings[0])
+	})
+	t.Run("landing load balanced", func(t *testing.T) {
+		entries := dblib.TNSEntries{
+			"DB.lan": {Name: "DB.lan", Desc: "(DESCRIPTION=(ADDRESS_LIST=(LOAD_BALANCE=on)(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(ADDRESS=(PROTOCOL=TCP)(HOST=db2)(PORT=1521)))(CONNECT_DATA=(SERVICE_NAME=DB)))"},
+			"FO.lan": {Name: "FO.lan", Desc: "(DESCRIPTION=(FAILOVER=on)(LOAD_BALANCE=off)(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=DB)))"},
+		}
+		balanced := loadBalanced(entries)
+		assert.Equal(t, map[string]bool{"DB.lan": true}, balanced, "only DB.lan is load balanced")
+		results := []checkResult{
+			{Name: "DB.lan", Address: "db2:1521", OK: true, DataGuard: standby},
+			{Name: "FO.lan", Address: "db1:1521", OK: true, DataGuard: standby},
+		}
+		warnings := dataguardLanding(results, balanced)
+		require.Len(t, warnings, 1, "load balanced alias has no landing address")
+		assert.True(t, strings.HasPrefix(warnings[0], "FO.lan "), "failover alias should be warned")
+	})
+	t.Run("transitions", func(t *testing.T) {
+		last := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+		state := map[string]dgStateEntry{
+			"DB.lan db1:1521": {Role: "PHYSICAL STANDBY", DBUniqueName: "DB_SITE1", Checked: last},
+			"DB.lan db2:1521": {Role: "PRIMARY", DBUniqueName: "DB_SITE2", Checked: last},
+		}
+		results := []checkResult{
+			{Name: "DB.lan", Address: "db1:1521", OK: true, DataGuard: primary},
+			{Name: "DB.lan", Address: "db2:1521", OK: false},
+			{Name: "DB.lan", Address: "db5:1521", OK: true, DataGuard: standby},
+		}
+		now := last.Add(time.Hour)
+		warnings := dataguardTransitions(results, state, now)
+		require.Len(t, warnings, 1, "one transition expected")
+		assert.Equal(t, "DB.lan db1:1521 changed role from PHYSICAL STANDBY to PRIMARY since 2026-10-17T08:00:00Z", warnings[0])
+		assert.Equal(t, dgStateEntry{Role: "PRIMARY", DBUniqueName: "DB_SITE1", Checked: now}, state["DB.lan db1:1521"])
+		assert.Equal(t, last, state["DB.lan db2:1521"].Checked, "unreachable address should keep its state")
+		assert.Contains(t, state, "DB.lan db5:1521", "new address should be added")
+	})
+	t.Run("state file", func(t *testing.T) {
+		dataguardState = filepath.Join(t.TempDir(), "state", "dataguard.json")
+		defer func() { dataguardState = "" }()
+		results := []checkResult{{Name: "DB.lan", Address: "db1:1521", OK: true, DataGuard: primary}}
+		warnings, err := checkDataGuard(results, nil)
+		require.NoErrorf(t, err, "first run failed: %s", err)
+		assert.Empty(t, warnings, "no warnings on first run expected")
+		assert.FileExists(t, dataguardState)
+		results[0].DataGuard = standby
+		warnings, err = checkDataGuard(results, nil)
+		require.NoErrorf(t, err, "second run failed: %s", err)
+		require.Len(t, warnings, 2, "standby connect and transition expected")
+		assert.Contains(t, warnings[1], "changed role from PRIMARY to PHYSICAL STANDBY")
+		err = os.WriteFile(dataguardState, []byte("no json"), 0600)
+		require.NoError(t, err)
+		_, err = checkDataGuard(results, nil)
+		assert.ErrorContains(t, err, "invalid data guard state")
+	})
+	t.Run("csv dataguard columns", func(t *testing.T) {
+		report := checkReport{Results: []checkResult{
+			{Name: "DB.lan", Address: "db2:1521", OK: true, DataGuard: standby},
+			{Name: "DB.lan", Address: "db1:1521", OK: false, Error: "ORA-12541: TNS:no listener"},
+		}}
+		var sb strings.Builder
+		err := writeCheckReport(&sb, outputCSV, report)
+		require.NoErrorf(t, err, "csv output failed: %s", err)
+		lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+		require.Len(t, lines, 4, "header, 2 records and summary expected")
+		assert.True(t, strings.HasSuffix(lines[0], ",address,database_role,apply_lag,transport_lag"), "data guard columns expected")
+		assert.True(t, strings.HasSuffix(lines[1], ",db2:1521,PHYSICAL STANDBY,+00 00:00:03,+00 00:00:00"), "record not expected")
+		assert.True(t, strings.HasSuffix(lines[2], ",db1:1521,,,"), "empty data guard columns expected")
+	})
+}
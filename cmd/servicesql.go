@@ -0,0 +1,152 @@
+// Package cmd commands
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var checkSQL = ""
+var checkExpect = ""
+var healthQueries []healthQuery
+
+// expect operators, longer operators first
+var expectOperators = []string{">=", "<=", "!=", ">", "<", "=", "~"}
+
+// healthQuery replaces the check query for the aliases matching Alias
+type healthQuery struct {
+	// Alias is a case insensitive regex for the alias names, empty matches all
+	Alias string `mapstructure:"alias"`
+	// SQL must return one value, empty keeps the default query
+	SQL string `mapstructure:"sql"`
+	// Expect is the assertion on the result, see parseExpect
+	Expect string `mapstructure:"expect"`
+	re     *regexp.Regexp
+	assert *resultAssertion
+	// inspect runs on the open connection after a successful check
+	inspect func(db *sql.DB)
+}
+
+// resultAssertion is a parsed expectation on a query result
+type resultAssertion struct {
+	op    string
+	value string
+	num   float64
+	re    *regexp.Regexp
+}
+
+func init() {
+	checkCmd.Flags().StringVar(&checkSQL, "sql", "", "query returning one value instead of the default check query, overrides check.queries")
+	checkCmd.Flags().StringVar(&checkExpect, "expect", "", "assertion on the query result: value, =value, !=value, ~regex, >n, >=n, <n or <=n")
+}
+
+// loadHealthQueries sets the health queries from --sql and --expect or from check.queries
+func loadHealthQueries() (err error) {
+	var queries []healthQuery
+	if checkSQL != "" || checkExpect != "" {
+		queries = []healthQuery{{SQL: checkSQL, Expect: checkExpect}}
+	} else if err = viper.UnmarshalKey("check.queries", &queries); err != nil {
+		err = fmt.Errorf("invalid check.queries: %v", err)
+		return
+	}
+	for i := range queries {
+		q := &queries[i]
+		if q.SQL == "" && q.Expect == "" {
+			err = fmt.Errorf("check.queries entry %d has neither sql nor expect", i+1)
+			return
+		}
+		if q.Alias != "" {
+			if q.re, err = regexp.Compile("(?i)^(" + q.Alias + ")$"); err != nil {
+				err = fmt.Errorf("invalid alias regex '%s': %v", q.Alias, err)
+				return
+			}
+		}
+		if q.assert, err = parseExpect(q.Expect); err != nil {
+			return
+		}
+	}
+	healthQueries = queries
+	log.Debugf("%d health queries loaded", len(healthQueries))
+	return
+}
+
+// healthQueryFor returns the first query matching the alias, an empty query if none
+func healthQueryFor(alias string) healthQuery {
+	for _, q := range healthQueries {
+		if q.re == nil || q.re.MatchString(alias) {
+			return q
+		}
+	}
+	return healthQuery{}
+}
+
+// active reports if the query needs a real login
+func (q healthQuery) active() bool {
+	return q.SQL != "" || q.assert != nil
+}
+
+// parseExpect parses an assertion. Without operator the result must be equal,
+// ~ matches a regex and the comparison operators need numbers
+func parseExpect(expect string) (a *resultAssertion, err error) {
+	if expect == "" {
+		return
+	}
+	a = &resultAssertion{op: "=", value: expect}
+	for _, op := range expectOperators {
+		if strings.HasPrefix(expect, op) {
+			a.op = op
+			a.value = strings.TrimSpace(strings.TrimPrefix(expect, op))
+			break
+		}
+	}
+	switch a.op {
+	case "~":
+		if a.re, err = regexp.Compile(a.value); err != nil {
+			err = fmt.Errorf("invalid expect regex '%s': %v", a.value, err)
+		}
+	case ">", ">=", "<", "<=":
+		if a.num, err = strconv.ParseFloat(a.value, 64); err != nil {
+			err = fmt.Errorf("expect '%s' needs a number", expect)
+		}
+	}
+	return
+}
+
+// check verifies the result, the error tells what was expected
+func (a *resultAssertion) check(result string) error {
+	result = strings.TrimSpace(result)
+	ok := false
+	switch a.op {
+	case "=":
+		ok = result == a.value
+	case "!=":
+		ok = result != a.value
+	case "~":
+		ok = a.re.MatchString(result)
+	default:
+		n, err := strconv.ParseFloat(result, 64)
+		if err != nil {
+			return fmt.Errorf("result '%s' is not a number, expected %s %s", result, a.op, a.value)
+		}
+		switch a.op {
+		case ">":
+			ok = n > a.num
+		case ">=":
+			ok = n >= a.num
+		case "<":
+			ok = n < a.num
+		case "<=":
+			ok = n <= a.num
+		}
+	}
+	if !ok {
+		return fmt.Errorf("result '%s' does not match %s %s", result, a.op, a.value)
+	}
+	return nil
+}
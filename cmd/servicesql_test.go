@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthQuery(t *testing.T) {
+	defer func() {
+		checkSQL, checkExpect = "", ""
+		healthQueries = nil
+		viper.Set("check.queries", nil)
+	}()
+
+	t.Run("expect", func(t *testing.T) {
+		type testTableType struct {
+			expect string
+			result string
+			ok     bool
+		}
+		for _, tt := range []testTableType{
+			{expect: "READ WRITE", result: "READ WRITE ", ok: true},
+			{expect: "=READ WRITE", result: "MOUNTED", ok: false},
+			{expect: "!=MOUNTED", result: "READ WRITE", ok: true},
+			{expect: "~^READ", result: "READ ONLY", ok: true},
+			{expect: "~^READ", result: "MOUNTED", ok: false},
+			{expect: ">0", result: "12", ok: true},
+			{expect: ">=12.5", result: "12", ok: false},
+			{expect: "< 100", result: "99.9", ok: true},
+			{expect: "<=0", result: "none", ok: false},
+		} {
+			a, err := parseExpect(tt.expect)
+			require.NoErrorf(t, err, "parse %s failed: %s", tt.expect, err)
+			err = a.check(tt.result)
+			assert.Equalf(t, tt.ok, err == nil, "%s on '%s': %v", tt.expect, tt.result, err)
+		}
+		a, err := parseExpect("")
+		assert.NoError(t, err)
+		assert.Nil(t, a, "no assertion expected")
+		_, err = parseExpect(">many")
+		assert.ErrorContains(t, err, "needs a number")
+		_, err = parseExpect("~(")
+		assert.ErrorContains(t, err, "invalid expect regex")
+	})
+	t.Run("config", func(t *testing.T) {
+		viper.Set("check.queries", []map[string]any{
+			{"alias": "XE.*", "sql": "select open_mode from v$database", "expect": "READ WRITE"},
+			{"expect": "~:FREEPDB1$"},
+		})
+		err := loadHealthQueries()
+		require.NoErrorf(t, err, "load failed: %s", err)
+		q := healthQueryFor("xe.local")
+		assert.Equal(t, "select open_mode from v$database", q.SQL, "alias regex should match case insensitive")
+		q = healthQueryFor("FREE.local")
+		assert.Empty(t, q.SQL, "default query expected")
+		assert.True(t, q.active(), "expect needs a login")
+		viper.Set("check.queries", []map[string]any{{"alias": "XE"}})
+		assert.ErrorContains(t, loadHealthQueries(), "neither sql nor expect")
+	})
+	t.Run("flags override config", func(t *testing.T) {
+		viper.Set("check.queries", []map[string]any{{"alias": "XE.*", "sql": "select 1 from dual"}})
+		checkSQL = "select count(*) from heartbeat"
+		err := loadHealthQueries()
+		require.NoErrorf(t, err, "load failed: %s", err)
+		assert.Equal(t, checkSQL, healthQueryFor("ORCL").SQL, "flag should apply to all aliases")
+		checkSQL = ""
+		healthQueries = nil
+		assert.False(t, healthQueryFor("ORCL").active(), "no query expected")
+	})
+}
@@ -0,0 +1,310 @@
+// Package cmd commands
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TNS packet types
+const (
+	tnsPacketConnect  = 1
+	tnsPacketRefuse   = 4
+	tnsPacketRedirect = 5
+	tnsPacketResend   = 11
+)
+
+// tnsConnectOffset is the offset of the connect data in a CONNECT packet
+const tnsConnectOffset = 58
+
+// waterfallWidth is the number of characters of the longest waterfall bar
+const waterfallWidth = 40
+
+var timingFlag = false
+
+var tnsPacketTypes = map[byte]string{
+	1: "CONNECT", 2: "ACCEPT", 3: "ACK", 4: "REFUSE", 5: "REDIRECT", 6: "DATA",
+	7: "NULL", 9: "ABORT", 11: "RESEND", 12: "MARKER", 13: "ATTENTION", 14: "CONTROL",
+}
+var tnsErrRe = regexp.MustCompile(`\(ERR=(\d+)\)`)
+
+// connectTiming holds the duration in ms of each connect phase of one address.
+// The phases are measured by a separate probe connect, so Login is only an
+// estimate: the time of the real connect not spent in the probed phases
+type connectTiming struct {
+	DNS      float64 `json:"dns_ms" yaml:"dns_ms"`
+	TCP      float64 `json:"tcp_ms" yaml:"tcp_ms"`
+	TLS      float64 `json:"tls_ms" yaml:"tls_ms"`
+	TNS      float64 `json:"tns_ms" yaml:"tns_ms"`
+	Login    float64 `json:"login_est_ms" yaml:"login_est_ms"`
+	TNSReply string  `json:"tns_reply,omitempty" yaml:"tns_reply,omitempty"`
+	Error    string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// timingAddress is the address and connect data a timing is measured for
+type timingAddress struct {
+	protocol    string
+	host        string
+	port        string
+	connectData string
+}
+
+func init() {
+	checkCmd.Flags().BoolVar(&timingFlag, "timing", false, "measure DNS, TCP, TLS, TNS handshake and estimate the login time of every address, implies --each-address")
+}
+
+// phases returns the waterfall characters and durations of the phases in order
+func (ct *connectTiming) phases() (marks string, ms []float64) {
+	return "dtsnl", []float64{ct.DNS, ct.TCP, ct.TLS, ct.TNS, ct.Login}
+}
+
+// total returns the sum of all phases
+func (ct *connectTiming) total() (sum float64) {
+	_, ms := ct.phases()
+	for _, v := range ms {
+		sum += v
+	}
+	return roundMS(sum)
+}
+
+// setLogin estimates the login phase from the elapsed time of the real connect
+func (ct *connectTiming) setLogin(elapsed time.Duration) {
+	if ct.Error != "" {
+		return
+	}
+	ct.Login = math.Max(0, roundMS(msOf(elapsed)-ct.total()))
+}
+
+func msOf(d time.Duration) float64 {
+	return roundMS(float64(d.Microseconds()) / 1000)
+}
+
+func roundMS(ms float64) float64 {
+	return math.Round(ms*100) / 100
+}
+
+// measureTiming runs the network phases of a connect to the first address of desc.
+// A failed phase ends the measurement and is reported in Error
+func measureTiming(desc string, wait time.Duration) (ct *connectTiming) {
+	ct = &connectTiming{}
+	a, err := newTimingAddress(desc)
+	if err != nil {
+		ct.Error = err.Error()
+		return
+	}
+	ip := strings.Trim(a.host, "[]")
+	start := time.Now()
+	if net.ParseIP(ip) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		var ips []string
+		ips, err = net.DefaultResolver.LookupHost(ctx, a.host)
+		cancel()
+		ct.DNS = msOf(time.Since(start))
+		if err != nil {
+			ct.Error = fmt.Sprintf("dns: %v", err)
+			return
+		}
+		ip = ips[0]
+	}
+	start = time.Now()
+	raw, err := net.DialTimeout("tcp", net.JoinHostPort(ip, a.port), wait)
+	ct.TCP = msOf(time.Since(start))
+	if err != nil {
+		ct.Error = fmt.Sprintf("tcp: %v", err)
+		return
+	}
+	defer func() { _ = raw.Close() }()
+	_ = raw.SetDeadline(time.Now().Add(wait))
+	var conn net.Conn = raw
+	if strings.EqualFold(a.protocol, "TCPS") {
+		// the certificate is verified by the real connect, only the handshake is timed here
+		//nolint gosec
+		tc := tls.Client(raw, &tls.Config{ServerName: a.host, InsecureSkipVerify: true})
+		start = time.Now()
+		err = tc.Handshake()
+		ct.TLS = msOf(time.Since(start))
+		if err != nil {
+			ct.Error = fmt.Sprintf("tls: %v", err)
+			return
+		}
+		conn = tc
+	}
+	start = time.Now()
+	ct.TNSReply, err = tnsHandshake(conn, a.connectData)
+	ct.TNS = msOf(time.Since(start))
+	if err != nil {
+		ct.Error = fmt.Sprintf("tns: %v", err)
+	}
+	return
+}
+
+// newTimingAddress returns the first address of desc and the connect data
+// sent to its listener
+func newTimingAddress(desc string) (a timingAddress, err error) {
+	nodes, err := parseDescriptor(desc, 1)
+	if err != nil {
+		return
+	}
+	addresses := findNodes(nodes, "ADDRESS")
+	if len(addresses) == 0 {
+		err = fmt.Errorf("no ADDRESS found")
+		return
+	}
+	a.protocol, _ = addresses[0].childValue("PROTOCOL")
+	a.host, _ = addresses[0].childValue("HOST")
+	a.port, _ = addresses[0].childValue("PORT")
+	if a.host == "" || a.port == "" {
+		err = fmt.Errorf("ADDRESS without HOST or PORT")
+		return
+	}
+	if a.protocol == "" {
+		a.protocol = "TCP"
+	}
+	service := ""
+	for _, key := range []string{"SERVICE_NAME", "SID"} {
+		if found := findNodes(nodes, key); len(found) > 0 {
+			service = "(" + key + "=" + found[0].Value + ")"
+			break
+		}
+	}
+	// keep the connect data short, longer data would need an extra packet
+	a.connectData = "(DESCRIPTION=(CONNECT_DATA=" + service + "(CID=(PROGRAM=tnscli)))" +
+		"(ADDRESS=(PROTOCOL=" + a.protocol + ")(HOST=" + a.host + ")(PORT=" + a.port + ")))"
+	return
+}
+
+// tnsConnectPacket builds a TNS CONNECT packet carrying data
+func tnsConnectPacket(data string) []byte {
+	p := make([]byte, tnsConnectOffset+len(data))
+	binary.BigEndian.PutUint16(p[0:], uint16(len(p)))
+	p[4] = tnsPacketConnect
+	binary.BigEndian.PutUint16(p[8:], 314)     // version
+	binary.BigEndian.PutUint16(p[10:], 300)    // lowest compatible version
+	binary.BigEndian.PutUint16(p[14:], 8192)   // session data unit
+	binary.BigEndian.PutUint16(p[16:], 65535)  // transport data unit
+	binary.BigEndian.PutUint16(p[18:], 0x7f08) // protocol characteristics
+	binary.BigEndian.PutUint16(p[22:], 1)      // value of 1 in hardware
+	binary.BigEndian.PutUint16(p[24:], uint16(len(data)))
+	binary.BigEndian.PutUint16(p[26:], tnsConnectOffset)
+	copy(p[tnsConnectOffset:], data)
+	return p
+}
+
+// tnsHandshake sends a CONNECT packet and returns the type of the listener reply,
+// the TNS error of a REFUSE is added. A RESEND is answered once
+func tnsHandshake(conn io.ReadWriter, data string) (reply string, err error) {
+	packet := tnsConnectPacket(data)
+	for try := 0; try < 2; try++ {
+		if _, err = conn.Write(packet); err != nil {
+			return
+		}
+		header := make([]byte, 8)
+		if _, err = io.ReadFull(conn, header); err != nil {
+			return
+		}
+		kind := header[4]
+		reply = tnsPacketTypes[kind]
+		if reply == "" {
+			reply = fmt.Sprintf("TYPE %d", kind)
+		}
+		if kind == tnsPacketResend {
+			continue
+		}
+		if kind == tnsPacketRefuse || kind == tnsPacketRedirect {
+			body := make([]byte, max(0, int(binary.BigEndian.Uint16(header))-len(header)))
+			if _, e := io.ReadFull(conn, body); e == nil {
+				if m := tnsErrRe.FindSubmatch(body); m != nil {
+					reply += " TNS-" + string(m[1])
+				}
+			}
+		}
+		return
+	}
+	return
+}
+
+// writeTimingTable prints the phases of all results with timing as table and waterfall
+// bar, scaled to the slowest address
+func writeTimingTable(w io.Writer, results []checkResult) (err error) {
+	longest := 0.0
+	for _, r := range results {
+		if r.Timing != nil {
+			longest = math.Max(longest, r.Timing.total())
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ADDRESS\tDNS ms\tTCP ms\tTLS ms\tTNS ms\tEST LOGIN ms\tTOTAL ms\tREPLY\tWATERFALL")
+	for _, r := range results {
+		ct := r.Timing
+		if ct == nil {
+			continue
+		}
+		_, ms := ct.phases()
+		cols := []string{checkLabel(r)}
+		for _, v := range ms {
+			cols = append(cols, fmt.Sprintf("%.2f", v))
+		}
+		cols = append(cols, fmt.Sprintf("%.2f", ct.total()), dashValue(ct.TNSReply))
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", strings.Join(cols, "\t"), waterfallBar(ct, longest))
+	}
+	if err = tw.Flush(); err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(w, "waterfall: d=dns t=tcp s=tls n=tns l=login (estimated)")
+	for _, r := range results {
+		if r.Timing != nil && r.Timing.Error != "" {
+			_, err = fmt.Fprintf(w, "%s: %s\n", checkLabel(r), r.Timing.Error)
+		}
+	}
+	return
+}
+
+// waterfallBar draws the phases one after the other, each phase which took any
+// time gets at least one character
+func waterfallBar(ct *connectTiming, longest float64) string {
+	marks, ms := ct.phases()
+	var sb strings.Builder
+	sb.WriteString("|")
+	for i, v := range ms {
+		if v <= 0 || longest <= 0 {
+			continue
+		}
+		n := max(1, int(math.Round(v/longest*waterfallWidth)))
+		sb.WriteString(strings.Repeat(marks[i:i+1], n))
+	}
+	sb.WriteString("|")
+	return sb.String()
+}
+
+// withTiming reports if any result has a timing
+func withTiming(results []checkResult) bool {
+	for _, r := range results {
+		if r.Timing != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// timingRecord returns the csv columns of a timing, empty without timing
+func timingRecord(ct *connectTiming) []string {
+	if ct == nil {
+		return make([]string, 6)
+	}
+	_, ms := ct.phases()
+	record := make([]string, 0, 6)
+	for _, v := range ms {
+		record = append(record, strconv.FormatFloat(v, 'f', 2, 64))
+	}
+	return append(record, ct.TNSReply)
+}
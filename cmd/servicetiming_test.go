@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListener answers each TNS CONNECT packet with the next reply packet
+func fakeListener(t *testing.T, replies ...[]byte) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoErrorf(t, err, "listen failed: %s", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		for _, reply := range replies {
+			header := make([]byte, 8)
+			if _, err = io.ReadFull(conn, header); err != nil {
+				return
+			}
+			body := make([]byte, int(binary.BigEndian.Uint16(header))-len(header))
+			if _, err = io.ReadFull(conn, body); err != nil {
+				return
+			}
+			_, _ = conn.Write(reply)
+		}
+	}()
+	return l.Addr().String()
+}
+
+// tnsReplyPacket builds a listener reply of the given type with data
+func tnsReplyPacket(kind byte, data string) []byte {
+	p := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint16(p[0:], uint16(len(p)))
+	p[4] = kind
+	copy(p[8:], data)
+	return p
+}
+
+func TestConnectTiming(t *testing.T) {
+	t.Run("connect packet", func(t *testing.T) {
+		data := "(DESCRIPTION=(CONNECT_DATA=(SERVICE_NAME=XE)))"
+		p := tnsConnectPacket(data)
+		assert.Equal(t, len(p), int(binary.BigEndian.Uint16(p[0:])), "packet length not expected")
+		assert.Equal(t, byte(tnsPacketConnect), p[4], "CONNECT type expected")
+		assert.Equal(t, len(data), int(binary.BigEndian.Uint16(p[24:])), "data length not expected")
+		assert.Equal(t, tnsConnectOffset, int(binary.BigEndian.Uint16(p[26:])), "data offset not expected")
+		assert.Equal(t, data, string(p[tnsConnectOffset:]))
+	})
+	t.Run("timing address", func(t *testing.T) {
+		a, err := newTimingAddress("(DESCRIPTION=(ADDRESS=(PROTOCOL=tcps)(HOST=db1)(PORT=2484))(CONNECT_DATA=(SERVICE_NAME=XE)))")
+		require.NoErrorf(t, err, "address failed: %s", err)
+		assert.Equal(t, "tcps", a.protocol)
+		assert.Equal(t, "2484", a.port)
+		assert.Contains(t, a.connectData, "(CONNECT_DATA=(SERVICE_NAME=XE)(CID=(PROGRAM=tnscli)))")
+		_, err = newTimingAddress("(DESCRIPTION=(CONNECT_DATA=(SID=XE)))")
+		assert.ErrorContains(t, err, "no ADDRESS")
+	})
+	t.Run("resend and refuse", func(t *testing.T) {
+		addr := fakeListener(t, tnsReplyPacket(tnsPacketResend, ""), tnsReplyPacket(tnsPacketRefuse, "(DESCRIPTION=(TMP=)(VSNNUM=0)(ERR=12514)(ERROR_STACK=(ERROR=(CODE=12514)(EMFI=4))))"))
+		conn, err := net.Dial("tcp", addr)
+		require.NoErrorf(t, err, "dial failed: %s", err)
+		defer func() { _ = conn.Close() }()
+		reply, err := tnsHandshake(conn, "(DESCRIPTION=(CONNECT_DATA=(SERVICE_NAME=unknown)))")
+		require.NoErrorf(t, err, "handshake failed: %s", err)
+		assert.Equal(t, "REFUSE TNS-12514", reply)
+	})
+	t.Run("measure", func(t *testing.T) {
+		addr := fakeListener(t, tnsReplyPacket(2, ""))
+		host, port, _ := net.SplitHostPort(addr)
+		ct := measureTiming(singleTestDesc(host, port), 5*time.Second)
+		require.Emptyf(t, ct.Error, "timing failed: %s", ct.Error)
+		assert.Equal(t, "ACCEPT", ct.TNSReply)
+		assert.Zero(t, ct.DNS, "no DNS for IP address expected")
+		assert.Zero(t, ct.TLS, "no TLS for TCP expected")
+		ct.TCP, ct.TNS = 1.5, 2.25
+		ct.setLogin(10 * time.Millisecond)
+		assert.Equal(t, 6.25, ct.Login, "estimated login should be the rest of the connect")
+		assert.Equal(t, 10.0, ct.total())
+	})
+	t.Run("closed port", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		_ = l.Close()
+		ct := measureTiming(singleTestDesc(host, port), time.Second)
+		assert.True(t, strings.HasPrefix(ct.Error, "tcp:"), "tcp error expected, got %s", ct.Error)
+		ct.setLogin(time.Second)
+		assert.Zero(t, ct.Login, "no login phase after failed phase")
+	})
+	t.Run("waterfall", func(t *testing.T) {
+		results := []checkResult{
+			{Name: "RAC.lan", Address: "10.0.0.1:1521", Timing: &connectTiming{DNS: 1, TCP: 1, TNS: 2, Login: 16, TNSReply: "ACCEPT"}},
+			{Name: "RAC.lan", Address: "10.0.0.2:1521", Timing: &connectTiming{DNS: 1, TCP: 4, Error: "tns: EOF"}},
+			{Name: "OTHER.lan"},
+		}
+		assert.Equal(t, "|ddttnnnnllllllllllllllllllllllllllllllll|", waterfallBar(results[0].Timing, 20))
+		assert.Equal(t, "|dt|", waterfallBar(results[1].Timing, 1000), "each phase should get one character")
+		var sb strings.Builder
+		err := writeTimingTable(&sb, results)
+		require.NoErrorf(t, err, "table failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "WATERFALL")
+		assert.Contains(t, out, "RAC.lan 10.0.0.2:1521: tns: EOF", "phase error expected")
+		assert.NotContains(t, out, "OTHER.lan", "result without timing should be skipped")
+	})
+	t.Run("csv timing columns", func(t *testing.T) {
+		report := checkReport{Results: []checkResult{{Name: "RAC.lan", Address: "10.0.0.1:1521", OK: true, Timing: &connectTiming{DNS: 0.5, TCP: 1, TNS: 2, Login: 16.25, TNSReply: "ACCEPT"}}}}
+		var sb strings.Builder
+		err := writeCheckReport(&sb, outputCSV, report)
+		require.NoErrorf(t, err, "csv output failed: %s", err)
+		lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+		require.Len(t, lines, 3, "header, 1 record and summary expected")
+		assert.True(t, strings.HasSuffix(lines[0], ",address,dns_ms,tcp_ms,tls_ms,tns_ms,login_est_ms,tns_reply"), "timing columns expected")
+		assert.True(t, strings.HasSuffix(lines[1], ",10.0.0.1:1521,0.50,1.00,0.00,2.00,16.25,ACCEPT"), "record not expected")
+	})
+}
+
+func singleTestDesc(host string, port string) string {
+	return "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=" + host + ")(PORT=" + port + "))(CONNECT_DATA=(SERVICE_NAME=XE)))"
+}
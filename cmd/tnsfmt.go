@@ -0,0 +1,152 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fmtCmd = &cobra.Command{
+		Use:   "fmt [files]",
+		Short: "format tnsnames.ora files",
+		Long: `rewrite tnsnames.ora files with canonical indentation and uppercase keywords.
+Comments, blank lines and ifile lines are kept, comments within an entry are moved in front of it.
+Without --write the formatted content is printed, --check lists the files which are not formatted
+and exits non-zero like gofmt -l`,
+		RunE:         fmtTns,
+		SilenceUsage: true,
+	}
+)
+
+var fmtWrite = false
+var fmtCheck = false
+
+func init() {
+	fmtCmd.Flags().BoolVarP(&fmtWrite, "write", "w", false, "write the result to the file instead of stdout, the previous version is kept as .bak")
+	fmtCmd.Flags().BoolVar(&fmtCheck, "check", false, "list files whose formatting differs and fail if there are any")
+	RootCmd.AddCommand(fmtCmd)
+}
+
+func fmtTns(_ *cobra.Command, args []string) (err error) {
+	if fmtWrite && fmtCheck {
+		err = fmt.Errorf("--write and --check cannot be used together")
+		return
+	}
+	files := args
+	if len(files) == 0 {
+		files = []string{filename}
+	}
+	failed := 0
+	unformatted := 0
+	for _, f := range files {
+		changed, e := fmtTnsFile(f)
+		switch {
+		case e != nil:
+			log.Errorf("%s: %v", f, e)
+			failed++
+		case changed && fmtCheck:
+			fmt.Println(f)
+			unformatted++
+		}
+	}
+	switch {
+	case failed > 0:
+		err = fmt.Errorf("%d of %d files cannot be formatted", failed, len(files))
+	case unformatted > 0:
+		err = fmt.Errorf("%d of %d files need formatting", unformatted, len(files))
+	}
+	return
+}
+
+// fmtTnsFile formats one file and reports if the result differs from the content
+func fmtTnsFile(file string) (changed bool, err error) {
+	//nolint gosec
+	content, err := os.ReadFile(file)
+	if err != nil {
+		err = fmt.Errorf("cannot read file: %v", err)
+		return
+	}
+	formatted, err := formatTnsContent(string(content), file)
+	if err != nil {
+		return
+	}
+	changed = formatted != string(content)
+	switch {
+	case fmtCheck:
+		log.Debugf("%s formatted: %v", file, !changed)
+	case fmtWrite:
+		if changed, err = writeIfChanged(file, []byte(formatted)); err == nil && changed {
+			log.Infof("%s formatted", file)
+		}
+	default:
+		fmt.Print(formatted)
+	}
+	return
+}
+
+// formatTnsContent returns the content with all entries pretty printed. Comments
+// are trimmed, runs of blank lines collapsed and ifile lines written as IFILE = name.
+// Entries which cannot be parsed fail the whole file, nothing is changed then
+func formatTnsContent(content string, file string) (formatted string, err error) {
+	var lines []string
+	blank := false
+	for _, it := range scanTnsContent(content, file) {
+		if it.Kind == itemBlank {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		switch it.Kind {
+		case itemComment:
+			lines = append(lines, strings.TrimSpace(it.Text))
+		case itemIfile:
+			m := ifileRe.FindStringSubmatch(it.Text)
+			lines = append(lines, "IFILE = "+m[1])
+		case itemEntry:
+			var entry []string
+			entry, err = formatTnsEntry(it)
+			if err != nil {
+				return
+			}
+			lines = append(lines, entry...)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	formatted = strings.Join(lines, "\n") + "\n"
+	return
+}
+
+// formatTnsEntry returns the lines of a pretty printed entry, comments within
+// the entry are returned first
+func formatTnsEntry(it tnsItem) (lines []string, err error) {
+	if strings.TrimSpace(it.Desc) == "" {
+		err = fmt.Errorf("line %d: %s has no descriptor", it.Line, it.Alias)
+		return
+	}
+	if it.Depth != 0 {
+		err = fmt.Errorf("line %d: %s has unbalanced parentheses, %d not closed", it.Line, it.Alias, it.Depth)
+		return
+	}
+	nodes, err := parseDescriptor(it.Desc, it.Line)
+	if err != nil {
+		return
+	}
+	for _, l := range strings.Split(it.Text, "\n")[1:] {
+		if l = strings.TrimSpace(l); strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	lines = append(lines, strings.Join(entryAliases(it.Alias), ", ")+" =")
+	lines = append(lines, formatNodes(nodes, "  "))
+	return
+}
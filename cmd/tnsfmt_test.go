@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/tnscli/test"
+)
+
+const fmttns = `   # fmt test
+
+
+ifile = "other.ora"
+XE.local, XE2.local=(description=(address_list=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))
+  # second address
+    (ADDRESS=(PROTOCOL=TCP)(HOST=db2)(PORT=1521)))(connect_data=(service_name=xe)))
+SID.local=
+  (DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db3)(PORT=1521))(CONNECT_DATA=(SID=XESID)))
+
+`
+
+const fmtexpected = `# fmt test
+
+IFILE = "other.ora"
+# second address
+XE.local, XE2.local =
+  (DESCRIPTION =
+    (ADDRESS_LIST =
+      (ADDRESS = (PROTOCOL = TCP)(HOST = db1)(PORT = 1521))
+      (ADDRESS = (PROTOCOL = TCP)(HOST = db2)(PORT = 1521))
+    )
+    (CONNECT_DATA = (SERVICE_NAME = xe))
+  )
+SID.local =
+  (DESCRIPTION =
+    (ADDRESS = (PROTOCOL = TCP)(HOST = db3)(PORT = 1521))
+    (CONNECT_DATA = (SID = XESID))
+  )
+`
+
+func TestTnsFmt(t *testing.T) {
+	test.InitTestDirs()
+	err := os.Chdir(test.TestDir)
+	require.NoErrorf(t, err, "ChDir failed")
+	fmtFile := path.Join(tnsAdminDir, "fmt.ora")
+	defer func() {
+		fmtWrite, fmtCheck = false, false
+	}()
+
+	t.Run("format content", func(t *testing.T) {
+		out, err := formatTnsContent(fmttns, fmtFile)
+		require.NoErrorf(t, err, "format failed: %s", err)
+		t.Log(out)
+		assert.Equal(t, fmtexpected, out)
+		again, err := formatTnsContent(out, fmtFile)
+		require.NoErrorf(t, err, "format again failed: %s", err)
+		assert.Equal(t, out, again, "format should be stable")
+	})
+	t.Run("invalid entry", func(t *testing.T) {
+		_, err := formatTnsContent("BAD.local=(DESCRIPTION=(ADDRESS=(HOST=x)\n", fmtFile)
+		assert.ErrorContains(t, err, "unbalanced parentheses")
+		_, err = formatTnsContent("garbage line\n", fmtFile)
+		assert.ErrorContains(t, err, "has no descriptor")
+	})
+	t.Run("check and write", func(t *testing.T) {
+		err := common.WriteStringToFile(fmtFile, fmttns)
+		require.NoErrorf(t, err, "Create test %s failed", fmtFile)
+		fmtCheck = true
+		err = fmtTns(nil, []string{fmtFile})
+		assert.ErrorContains(t, err, "1 of 1 files need formatting")
+		fmtCheck, fmtWrite = false, true
+		err = fmtTns(nil, []string{fmtFile})
+		require.NoErrorf(t, err, "write failed: %s", err)
+		content, err := os.ReadFile(fmtFile)
+		require.NoErrorf(t, err, "read %s failed: %s", fmtFile, err)
+		assert.Equal(t, fmtexpected, string(content))
+		assert.FileExists(t, fmtFile+".bak", "backup expected")
+		fmtCheck, fmtWrite = true, false
+		assert.NoError(t, fmtTns(nil, []string{fmtFile}), "formatted file should pass check")
+		fmtWrite = true
+		assert.ErrorContains(t, fmtTns(nil, []string{fmtFile}), "cannot be used together")
+	})
+}
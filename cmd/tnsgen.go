@@ -0,0 +1,252 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/tommi2day/gomodules/dblib"
+	"github.com/tommi2day/gomodules/ldaplib"
+)
+
+const formatOra = "ora"
+const groupByDomain = "domain"
+const defaultGroup = "default"
+
+// defaultTnsTemplate renders a tnsnames.ora file with header, groups and includes
+const defaultTnsTemplate = `# tnsnames.ora generated by {{.Version}}
+# source: {{.Context}}
+# generated: {{.Generated}}
+{{- range .Includes}}
+IFILE = {{.}}
+{{- end}}
+{{- range .Groups}}
+{{- if .Name}}
+
+# ===== {{.Name}} =====
+{{- end}}
+{{- range .Entries}}
+
+# Location: {{.Location}}
+{{.Name}} =
+{{.Desc}}
+{{- end}}
+{{- end}}
+`
+
+var tnsTemplateFile = ""
+var tnsGroupBy = ""
+var tnsSplit = false
+var tnsIfileDir = ""
+var groupFileRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// tnsFileData is passed to the tnsnames.ora template
+type tnsFileData struct {
+	// Version is the tnscli version
+	Version string
+	// Context is the Oracle Context the entries are read from
+	Context string
+	// Generated is the generation time as RFC3339
+	Generated string
+	// Groups holds the entries of this file, a single unnamed group without grouping
+	Groups []tnsFileGroup
+	// Includes are the fragment files of a split output
+	Includes []string
+}
+
+// tnsFileGroup is a group of entries sorted by name
+type tnsFileGroup struct {
+	Name    string
+	Entries []tnsFileEntry
+}
+
+// tnsFileEntry is one entry with the pretty printed descriptor in Desc
+type tnsFileEntry struct {
+	Name     string
+	Location string
+	Desc     string
+	Raw      string
+}
+
+func init() {
+	ldapReadCmd.Flags().StringVar(&tnsTemplateFile, "template", "", "go template file to render format ora, default built in")
+	ldapReadCmd.Flags().StringVar(&tnsGroupBy, "group-by", "", "group format ora entries by 'domain' or a LDAP attribute")
+	ldapReadCmd.Flags().BoolVar(&tnsSplit, "split", false, "write each group to a fragment file included with IFILE by --ldap.tnstarget")
+	ldapReadCmd.Flags().StringVar(&tnsIfileDir, "ifile-dir", "", "directory of the fragments in the IFILE lines, default directory of --ldap.tnstarget")
+}
+
+// checkOraFlags verifies the generator flags are used with format ora
+func checkOraFlags(format string, target string) error {
+	if format != formatOra {
+		if tnsTemplateFile != "" || tnsGroupBy != "" || tnsSplit || tnsIfileDir != "" {
+			return fmt.Errorf("--template, --group-by, --split and --ifile-dir need --format %s", formatOra)
+		}
+		return nil
+	}
+	if tnsSplit && (target == "" || tnsGroupBy == "") {
+		return fmt.Errorf("--split needs --ldap.tnstarget and --group-by")
+	}
+	return nil
+}
+
+// loadTnsTemplate parses the template file or the built-in template
+func loadTnsTemplate(file string) (tmpl *template.Template, err error) {
+	text := defaultTnsTemplate
+	if file != "" {
+		var content []byte
+		//nolint gosec
+		content, err = os.ReadFile(file)
+		if err != nil {
+			err = fmt.Errorf("cannot read template: %v", err)
+			return
+		}
+		text = string(content)
+	}
+	tmpl, err = template.New("tnsnames").Option("missingkey=error").Parse(text)
+	if err != nil {
+		err = fmt.Errorf("invalid template %s: %v", file, err)
+	}
+	return
+}
+
+// ldapGroupFunc returns the function assigning an entry to its group
+func ldapGroupFunc(lc *ldaplib.LdapConfigType, contextDN string, groupBy string) (groupOf func(dblib.TNSEntry) string, err error) {
+	switch strings.ToLower(groupBy) {
+	case "":
+		groupOf = func(dblib.TNSEntry) string { return "" }
+	case groupByDomain:
+		groupOf = func(e dblib.TNSEntry) string {
+			if d := newAliasNameParts(e.Name).Domain; d != "" {
+				return d
+			}
+			return defaultGroup
+		}
+	default:
+		var values map[string]string
+		values, err = ldapAttributeValues(lc, contextDN, groupBy)
+		if err != nil {
+			return
+		}
+		groupOf = func(e dblib.TNSEntry) string {
+			if v := values[dnKey(e.Location)]; v != "" {
+				return v
+			}
+			return defaultGroup
+		}
+	}
+	return
+}
+
+// ldapAttributeValues returns the first value of attr for all net services and alias objects by DN
+func ldapAttributeValues(lc *ldaplib.LdapConfigType, contextDN string, attr string) (values map[string]string, err error) {
+	entries, err := lc.Search(contextDN, ldapSearchFilter("", false), []string{attr}, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases)
+	if err != nil {
+		err = fmt.Errorf("search %s failed: %v", attr, err)
+		return
+	}
+	values = map[string]string{}
+	for _, e := range entries {
+		values[dnKey(e.DN)] = e.GetAttributeValue(attr)
+	}
+	log.Debugf("%d entries with attribute %s found", len(values), attr)
+	return
+}
+
+// groupTnsEntries sorts the entries into groups ordered by name, the default group last
+func groupTnsEntries(tnsEntries dblib.TNSEntries, groupOf func(dblib.TNSEntry) string) (groups []tnsFileGroup) {
+	byGroup := map[string][]tnsFileEntry{}
+	for _, alias := range getSortedAliases(tnsEntries) {
+		e := tnsEntries[alias]
+		g := groupOf(e)
+		byGroup[g] = append(byGroup[g], tnsFileEntry{Name: e.Name, Location: e.Location, Desc: formatDescriptor(e.Desc, "  "), Raw: e.Desc})
+	}
+	names := getSortedAliases(byGroup)
+	sort.SliceStable(names, func(i, j int) bool { return names[i] != defaultGroup && names[j] == defaultGroup })
+	for _, name := range names {
+		groups = append(groups, tnsFileGroup{Name: name, Entries: byGroup[name]})
+	}
+	return
+}
+
+// writeOraFiles renders the entries to w. With --split each group is written to a
+// fragment next to target and w gets the IFILE lines only
+func writeOraFiles(w io.Writer, tnsEntries dblib.TNSEntries, groupOf func(dblib.TNSEntry) string, target string) (err error) {
+	tmpl, err := loadTnsTemplate(tnsTemplateFile)
+	if err != nil {
+		return
+	}
+	data := tnsFileData{
+		Version:   GetVersion(false),
+		Context:   contextDN,
+		Generated: time.Now().Format(time.RFC3339),
+		Groups:    groupTnsEntries(tnsEntries, groupOf),
+	}
+	if !tnsSplit {
+		return tmpl.Execute(w, data)
+	}
+	// groups differing only by case or punctuation share a fragment name
+	files := map[string]string{}
+	for _, g := range data.Groups {
+		file := fragmentFile(target, g.Name)
+		if other, exists := files[file]; exists {
+			err = fmt.Errorf("groups %s and %s both map to fragment %s", other, g.Name, file)
+			return
+		}
+		files[file] = g.Name
+	}
+	index := data
+	index.Groups = nil
+	for _, g := range data.Groups {
+		fragment := data
+		fragment.Groups = []tnsFileGroup{g}
+		file := fragmentFile(target, g.Name)
+		var sb strings.Builder
+		if err = tmpl.Execute(&sb, fragment); err != nil {
+			return
+		}
+		// clients may read the fragment at any time, replace it in one step
+		var changed bool
+		if changed, err = writeIfChanged(file, []byte(sb.String())); err != nil {
+			err = fmt.Errorf("cannot write %s: %v", file, err)
+			return
+		}
+		if changed {
+			log.Infof("%d entries of group %s written to %s", len(g.Entries), g.Name, file)
+		} else {
+			log.Debugf("%s unchanged", file)
+		}
+		index.Includes = append(index.Includes, ifileName(target, file))
+	}
+	return tmpl.Execute(w, index)
+}
+
+// fragmentFile returns the file name of a group, tnsnames.ora becomes tnsnames_<group>.ora
+func fragmentFile(target string, group string) string {
+	name := strings.Trim(groupFileRe.ReplaceAllString(strings.ToLower(group), "_"), "_")
+	if name == "" {
+		name = defaultGroup
+	}
+	ext := filepath.Ext(target)
+	return strings.TrimSuffix(target, ext) + "_" + name + ext
+}
+
+// ifileName returns the fragment path to use in the IFILE line
+func ifileName(target string, file string) string {
+	dir := tnsIfileDir
+	if dir == "" {
+		var err error
+		if dir, err = filepath.Abs(filepath.Dir(target)); err != nil {
+			dir = filepath.Dir(target)
+		}
+	}
+	return filepath.Join(dir, filepath.Base(file))
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommi2day/gomodules/common"
+	"github.com/tommi2day/gomodules/dblib"
+)
+
+func TestTnsGen(t *testing.T) {
+	ctx := "cn=OracleContext," + LdapBaseDn
+	entries := dblib.TNSEntries{
+		"xe.prod": {Name: "xe.prod", Location: "cn=xe.prod," + ctx, Desc: "(DESCRIPTION=(ADDRESS_LIST=(ADDRESS=(PROTOCOL=TCP)(HOST=db1)(PORT=1521))(ADDRESS=(PROTOCOL=TCP)(HOST=db2)(PORT=1521)))(CONNECT_DATA=(SERVICE_NAME=XE)))"},
+		"db.test": {Name: "db.test", Location: "cn=db.test," + ctx, Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db3)(PORT=1521))(CONNECT_DATA=(SID=DB)))"},
+		"orcl":    {Name: "orcl", Location: "cn=orcl," + ctx, Desc: "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db4)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=ORCL)))"},
+	}
+	byDomain := func(e dblib.TNSEntry) string {
+		if d := newAliasNameParts(e.Name).Domain; d != "" {
+			return d
+		}
+		return defaultGroup
+	}
+	defer func() {
+		tnsTemplateFile, tnsGroupBy, tnsSplit, tnsIfileDir = "", "", false, ""
+	}()
+
+	t.Run("pretty descriptor", func(t *testing.T) {
+		expected := `  (DESCRIPTION =
+    (ADDRESS_LIST =
+      (ADDRESS = (PROTOCOL = TCP)(HOST = db1)(PORT = 1521))
+      (ADDRESS = (PROTOCOL = TCP)(HOST = db2)(PORT = 1521))
+    )
+    (CONNECT_DATA = (SERVICE_NAME = XE))
+  )`
+		assert.Equal(t, expected, formatDescriptor(entries["xe.prod"].Desc, "  "))
+		assert.Equal(t, "(DESCRIPTION=(broken", formatDescriptor("(DESCRIPTION=(broken", ""), "invalid descriptor should be unchanged")
+	})
+	t.Run("groups", func(t *testing.T) {
+		groups := groupTnsEntries(entries, byDomain)
+		require.Len(t, groups, 3, "3 groups expected")
+		assert.Equal(t, "prod", groups[0].Name)
+		assert.Equal(t, "test", groups[1].Name)
+		assert.Equal(t, defaultGroup, groups[2].Name, "default group should be last")
+		assert.Equal(t, "orcl", groups[2].Entries[0].Name)
+	})
+	t.Run("flags", func(t *testing.T) {
+		tnsGroupBy = groupByDomain
+		assert.ErrorContains(t, checkOraFlags(formatTNS, ""), "need --format ora")
+		assert.NoError(t, checkOraFlags(formatOra, ""))
+		tnsSplit = true
+		assert.ErrorContains(t, checkOraFlags(formatOra, ""), "--split needs")
+		tnsGroupBy, tnsSplit = "", false
+	})
+	t.Run("render", func(t *testing.T) {
+		contextDN = ctx
+		var sb strings.Builder
+		err := writeOraFiles(&sb, entries, byDomain, "")
+		require.NoErrorf(t, err, "render failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "# source: "+ctx+"\n# generated: ")
+		assert.Contains(t, out, "\n\n# ===== prod =====\n\n# Location: cn=xe.prod,"+ctx+"\nxe.prod =\n  (DESCRIPTION =\n")
+		assert.Less(t, strings.Index(out, "===== test"), strings.Index(out, "===== default"), "group order not expected")
+		assert.True(t, strings.HasSuffix(out, "  )\n"), "output should end with descriptor")
+		n := 0
+		for _, item := range scanTnsContent(out, "generated.ora") {
+			if item.Kind == itemEntry {
+				n++
+				_, e := parseDescriptor(item.Desc, item.Line)
+				assert.NoErrorf(t, e, "descriptor of %s not parseable", item.Alias)
+			}
+		}
+		assert.Equal(t, 3, n, "generated file should have 3 entries")
+	})
+	t.Run("custom template", func(t *testing.T) {
+		file := path.Join(t.TempDir(), "tns.tmpl")
+		require.NoError(t, common.WriteStringToFile(file, "{{range .Groups}}{{range .Entries}}{{.Name}}={{.Raw}}\n{{end}}{{end}}"))
+		tnsTemplateFile = file
+		var sb strings.Builder
+		err := writeOraFiles(&sb, entries, func(dblib.TNSEntry) string { return "" }, "")
+		tnsTemplateFile = ""
+		require.NoErrorf(t, err, "render failed: %s", err)
+		assert.Equal(t, "db.test="+entries["db.test"].Desc+"\norcl="+entries["orcl"].Desc+"\nxe.prod="+entries["xe.prod"].Desc+"\n", sb.String())
+		require.NoError(t, common.WriteStringToFile(file, "{{.Missing}}"))
+		tnsTemplateFile = file
+		err = writeOraFiles(&sb, entries, byDomain, "")
+		tnsTemplateFile = ""
+		assert.Error(t, err, "unknown field should fail")
+	})
+	t.Run("split", func(t *testing.T) {
+		dir := t.TempDir()
+		target := path.Join(dir, "tnsnames.ora")
+		tnsSplit = true
+		tnsIfileDir = "/u01/network/admin"
+		var sb strings.Builder
+		err := writeOraFiles(&sb, entries, byDomain, target)
+		tnsSplit, tnsIfileDir = false, ""
+		require.NoErrorf(t, err, "split failed: %s", err)
+		out := sb.String()
+		t.Log(out)
+		assert.Contains(t, out, "IFILE = /u01/network/admin/tnsnames_prod.ora\nIFILE = /u01/network/admin/tnsnames_test.ora\nIFILE = /u01/network/admin/tnsnames_default.ora\n")
+		assert.NotContains(t, out, "Location:", "index should only include fragments")
+		c, err := os.ReadFile(path.Join(dir, "tnsnames_prod.ora"))
+		require.NoErrorf(t, err, "fragment missing: %s", err)
+		assert.Contains(t, string(c), "xe.prod =")
+		assert.NotContains(t, string(c), "orcl =")
+		assert.Equal(t, path.Join(dir, "tnsnames_a_b.ora"), fragmentFile(target, "A/B"))
+	})
+	t.Run("split replaces fragments", func(t *testing.T) {
+		dir := t.TempDir()
+		target := path.Join(dir, "tnsnames.ora")
+		fragment := path.Join(dir, "tnsnames_prod.ora")
+		err := common.WriteStringToFile(fragment, "old\n")
+		require.NoErrorf(t, err, "Create test %s failed", fragment)
+		tnsSplit = true
+		var sb strings.Builder
+		err = writeOraFiles(&sb, entries, byDomain, target)
+		tnsSplit = false
+		require.NoErrorf(t, err, "split failed: %s", err)
+		c, err := os.ReadFile(fragment)
+		require.NoErrorf(t, err, "fragment missing: %s", err)
+		assert.Contains(t, string(c), "xe.prod =")
+		c, err = os.ReadFile(fragment + ".bak")
+		require.NoErrorf(t, err, "backup missing: %s", err)
+		assert.Equal(t, "old\n", string(c), "backup should keep the previous fragment")
+		tmp, _ := filepath.Glob(path.Join(dir, ".*.tmp"))
+		assert.Empty(t, tmp, "temp files left")
+	})
+	t.Run("split fragment collision", func(t *testing.T) {
+		dir := t.TempDir()
+		target := path.Join(dir, "tnsnames.ora")
+		tnsSplit = true
+		var sb strings.Builder
+		err := writeOraFiles(&sb, entries, func(e dblib.TNSEntry) string {
+			if e.Name == "orcl" {
+				return "a_b"
+			}
+			return "a.b"
+		}, target)
+		tnsSplit = false
+		require.Error(t, err, "groups with the same fragment should fail")
+		assert.Contains(t, err.Error(), "tnsnames_a_b.ora", "fragment not named")
+		_, serr := os.Stat(path.Join(dir, "tnsnames_a_b.ora"))
+		assert.True(t, os.IsNotExist(serr), "no fragment should be written")
+	})
+}
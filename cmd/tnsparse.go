@@ -0,0 +1,398 @@
+// Package cmd commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// kinds of top level items in a tnsnames.ora file
+const (
+	itemBlank = iota
+	itemComment
+	itemIfile
+	itemEntry
+)
+
+// tnsItem is one top level element of a tnsnames.ora file
+type tnsItem struct {
+	Kind  int
+	File  string
+	Line  int
+	Alias string
+	Desc  string
+	Text  string
+	// Depth is the parenthesis depth at the end of an entry, 0 if balanced
+	Depth int
+}
+
+// tnsNode is one (KEY=value) or (KEY=(...)(...)) element of a descriptor
+type tnsNode struct {
+	Key      string
+	Value    string
+	Children []*tnsNode
+	Line     int
+}
+
+var ifileRe = regexp.MustCompile(`(?i)^\s*ifile\s*=\s*(.+?)\s*$`)
+var entryStartRe = regexp.MustCompile(`^[A-Za-z0-9_][\w.,$#-]*\s*(,\s*[\w.$#-]+\s*)*=`)
+
+// scanTnsFile splits a tnsnames.ora file into comments, ifiles and entries
+func scanTnsFile(file string) (items []tnsItem, err error) {
+	//nolint gosec
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	items = scanTnsContent(string(content), file)
+	return
+}
+
+// scanTnsContent splits tnsnames.ora content into comments, ifiles and entries
+func scanTnsContent(content string, file string) (items []tnsItem) {
+	var cur *tnsItem
+	seenParen := false
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		if cur != nil {
+			// a new alias in column 1 terminates an unbalanced entry
+			if (cur.Depth > 0 || !seenParen) && entryStartRe.MatchString(line) {
+				items = append(items, *cur)
+				cur = nil
+			} else {
+				cur.Text += "\n" + line
+				if !strings.HasPrefix(trimmed, "#") {
+					cur.Desc += "\n" + line
+					cur.Depth += parenDepth(line)
+					seenParen = seenParen || strings.Contains(line, "(")
+				}
+				if seenParen && cur.Depth <= 0 {
+					items = append(items, *cur)
+					cur = nil
+				}
+				continue
+			}
+		}
+		switch {
+		case trimmed == "":
+			items = append(items, tnsItem{Kind: itemBlank, File: file, Line: lineNo, Text: line})
+		case strings.HasPrefix(trimmed, "#"):
+			items = append(items, tnsItem{Kind: itemComment, File: file, Line: lineNo, Text: line})
+		case ifileRe.MatchString(line):
+			m := ifileRe.FindStringSubmatch(line)
+			items = append(items, tnsItem{Kind: itemIfile, File: file, Line: lineNo, Text: line, Desc: strings.Trim(m[1], `"'`)})
+		case strings.Contains(line, "="):
+			alias, desc, _ := strings.Cut(line, "=")
+			cur = &tnsItem{Kind: itemEntry, File: file, Line: lineNo, Alias: strings.TrimSpace(alias), Desc: desc, Text: line}
+			cur.Depth = parenDepth(desc)
+			seenParen = strings.Contains(desc, "(")
+			if seenParen && cur.Depth <= 0 {
+				items = append(items, *cur)
+				cur = nil
+			}
+		default:
+			// garbage line, report it as entry without descriptor
+			items = append(items, tnsItem{Kind: itemEntry, File: file, Line: lineNo, Alias: trimmed, Text: line})
+		}
+	}
+	if cur != nil {
+		items = append(items, *cur)
+	}
+	return
+}
+
+// parenDepth returns the difference of opening and closing parentheses outside quotes
+func parenDepth(s string) (d int) {
+	quoted := false
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			d++
+		case c == ')':
+			d--
+		}
+	}
+	return
+}
+
+// ifilePath resolves an ifile name relative to the including file
+func ifilePath(name string, including string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(including), name)
+}
+
+// entryAliases splits an alias list like "A,B" into its names
+func entryAliases(alias string) (names []string) {
+	for _, a := range strings.Split(alias, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			names = append(names, a)
+		}
+	}
+	return
+}
+
+// parseDescriptor parses a descriptor into a tree of nodes. line is the
+// number of the first descriptor line and used for error messages
+func parseDescriptor(desc string, line int) (nodes []*tnsNode, err error) {
+	p := &descParser{s: desc, line: line}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			break
+		}
+		var n *tnsNode
+		n, err = p.node()
+		if err != nil {
+			return
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 0 {
+		err = fmt.Errorf("line %d: empty descriptor", line)
+	}
+	return
+}
+
+type descParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *descParser) skipSpace() {
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch c {
+		case '\n':
+			p.line++
+		case ' ', '\t', '\r':
+		default:
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *descParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// node parses (KEY=value) or (KEY=(..)(..))
+func (p *descParser) node() (n *tnsNode, err error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		err = p.errorf("expected '(' at '%s'", p.rest())
+		return
+	}
+	p.pos++
+	n = &tnsNode{Line: p.line}
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("=()", rune(p.s[p.pos])) {
+		if p.s[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+	n.Key = strings.TrimSpace(p.s[start:p.pos])
+	if n.Key == "" {
+		err = p.errorf("missing keyword")
+		return
+	}
+	if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+		err = p.errorf("missing '=' after %s", n.Key)
+		return
+	}
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '(' {
+		for p.pos < len(p.s) && p.s[p.pos] == '(' {
+			var c *tnsNode
+			c, err = p.node()
+			if err != nil {
+				return
+			}
+			n.Children = append(n.Children, c)
+			p.skipSpace()
+		}
+	} else {
+		n.Value, err = p.value()
+		if err != nil {
+			return
+		}
+	}
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		err = p.errorf("missing ')' for %s", n.Key)
+		return
+	}
+	p.pos++
+	return
+}
+
+// value reads a plain or quoted value up to the closing parenthesis
+func (p *descParser) value() (v string, err error) {
+	start := p.pos
+	quoted := false
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\n':
+			p.line++
+		case quoted:
+		case c == '(':
+			err = p.errorf("unexpected '(' in value")
+			return
+		case c == ')':
+			v = strings.TrimSpace(p.s[start:p.pos])
+			return
+		}
+		p.pos++
+	}
+	if quoted {
+		err = p.errorf("unterminated quote")
+		return
+	}
+	v = strings.TrimSpace(p.s[start:p.pos])
+	return
+}
+
+func (p *descParser) rest() string {
+	r := p.s[p.pos:]
+	if len(r) > 20 {
+		r = r[:20] + "..."
+	}
+	return strings.TrimSpace(r)
+}
+
+// findNodes returns all nodes with the given key below the given nodes
+func findNodes(nodes []*tnsNode, key string) (found []*tnsNode) {
+	for _, n := range nodes {
+		if strings.EqualFold(n.Key, key) {
+			found = append(found, n)
+		}
+		found = append(found, findNodes(n.Children, key)...)
+	}
+	return
+}
+
+// childValue returns the value of the direct child with the given key
+func (n *tnsNode) childValue(key string) (v string, ok bool) {
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Key, key) {
+			return c.Value, true
+		}
+	}
+	return
+}
+
+// descPath is a flattened descriptor value with its position in the tree
+type descPath struct {
+	Path  string
+	Value string
+}
+
+// flattenDescriptor returns all leaf values with paths like
+// DESCRIPTION/ADDRESS_LIST/ADDRESS[2]/HOST. Repeated keys are numbered
+func flattenDescriptor(nodes []*tnsNode) (paths []descPath) {
+	return flattenNodes(nodes, "")
+}
+
+func flattenNodes(nodes []*tnsNode, prefix string) (paths []descPath) {
+	total := map[string]int{}
+	for _, n := range nodes {
+		total[strings.ToUpper(n.Key)]++
+	}
+	count := map[string]int{}
+	for _, n := range nodes {
+		key := strings.ToUpper(n.Key)
+		count[key]++
+		if total[key] > 1 {
+			key = fmt.Sprintf("%s[%d]", key, count[key])
+		}
+		p := key
+		if prefix != "" {
+			p = prefix + "/" + key
+		}
+		if len(n.Children) == 0 {
+			paths = append(paths, descPath{Path: p, Value: n.Value})
+			continue
+		}
+		paths = append(paths, flattenNodes(n.Children, p)...)
+	}
+	return
+}
+
+// formatDescriptor pretty prints a descriptor. Nodes with only values as children
+// are written on one line, all others get one line per child indented by two spaces
+// per level, keywords in uppercase. Descriptors which cannot be parsed are returned unchanged
+func formatDescriptor(desc string, indent string) string {
+	nodes, err := parseDescriptor(desc, 1)
+	if err != nil {
+		return desc
+	}
+	return formatNodes(nodes, indent)
+}
+
+// formatNodes writes the nodes of a parsed descriptor with keywords in uppercase
+func formatNodes(nodes []*tnsNode, indent string) string {
+	var sb strings.Builder
+	for i, n := range nodes {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		writeNode(&sb, n, indent)
+	}
+	return sb.String()
+}
+
+func writeNode(sb *strings.Builder, n *tnsNode, indent string) {
+	sb.WriteString(indent)
+	if n.flat() {
+		sb.WriteString(n.inline())
+		return
+	}
+	sb.WriteString("(" + strings.ToUpper(n.Key) + " =\n")
+	for _, c := range n.Children {
+		writeNode(sb, c, indent+"  ")
+		sb.WriteString("\n")
+	}
+	sb.WriteString(indent + ")")
+}
+
+// flat reports if all children of a node are values
+func (n *tnsNode) flat() bool {
+	for _, c := range n.Children {
+		if len(c.Children) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// inline returns the node on one line
+func (n *tnsNode) inline() string {
+	if len(n.Children) == 0 {
+		return "(" + strings.ToUpper(n.Key) + " = " + n.Value + ")"
+	}
+	var sb strings.Builder
+	sb.WriteString("(" + strings.ToUpper(n.Key) + " = ")
+	for _, c := range n.Children {
+		sb.WriteString(c.inline())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}